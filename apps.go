@@ -0,0 +1,48 @@
+package gears
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+var appName string
+
+// SetAppName sets the name of the program, for config files shared by
+// several programs. Keys in the "apps.<name>" section of a config file
+// apply only to that program, and take precedence over the rest of the
+// file. The sections of other programs are ignored.
+func SetAppName(name string) {
+	if !regexp.MustCompile(`^[a-zA-Z0-9_-]+$`).MatchString(name) {
+		log.Fatalf("App name '%s' is invalid! Must only contain letters, numbers, '-' and '_'.", name)
+	}
+	appName = name
+}
+
+// splitApps separates the keys of the "apps" section of a config file from
+// the rest of its keys, unless there is a flag named "apps". It returns the
+// keys of this program's section, and drops those of other programs, which
+// are all of them when no app name is set. Keys that are flags themselves,
+// such as "apps.dir" for an apps-dir flag, are kept.
+func splitApps(entries []configEntry) ([]configEntry, []configEntry) {
+	if _, exists := flags["apps"]; exists {
+		return entries, nil
+	}
+
+	var rest []configEntry
+	var app []configEntry
+	for _, entry := range entries {
+		path, isApp := strings.CutPrefix(entry.key, "apps.")
+		if _, isFlag := flags[configFlagName(entry.key)]; !isApp || isFlag {
+			rest = append(rest, entry)
+			continue
+		}
+		name, key, _ := strings.Cut(path, ".")
+		if appName != "" && name == appName && key != "" {
+			entry.label = entry.key
+			entry.key = key
+			app = append(app, entry)
+		}
+	}
+	return rest, app
+}
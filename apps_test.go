@@ -0,0 +1,116 @@
+package gears
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApps(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "color", ValueType: "bool"}); err != nil {
+		log.Fatal(err)
+	}
+	SetAppName("serve")
+	isolateEnv(t)
+
+	dir := t.TempDir()
+	writeConfigFiles(dir, map[string]string{
+		"config.json": `{
+  "color": true,
+  "port": 8000,
+  "apps": {
+    "serve": {"port": 8080},
+    "fetch": {"retries": 3, "port": 1}
+  }
+}`,
+		"config.toml": "port = 1\n\n[apps.serve]\nport = 9090\n\n[apps.other]\nunknown = true\n",
+	})
+	AddConfigFile(filepath.Join(dir, "config.json"))
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if IntValue("port") != 8080 {
+		t.Error("app section did not take precedence over shared keys")
+	}
+	if !BoolValue("color") {
+		t.Error("shared keys were not applied")
+	}
+	if source := SourceOf("port"); source.Block != "apps.serve" {
+		t.Errorf("port has source %v; expected apps.serve", source)
+	}
+
+	AddConfigFile(filepath.Join(dir, "config.toml"))
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if IntValue("port") != 9090 {
+		t.Error("app section in TOML was not applied")
+	}
+
+	tests_reset()
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	SetAppName("serve")
+	isolateEnv(t)
+	writeConfigFiles(dir, map[string]string{"bad.json": `{"apps": {"serve": {"prot": 1}}}`})
+	path := filepath.Join(dir, "bad.json")
+	AddConfigFile(path)
+	want := `config.json:1:21: "apps.serve.prot": option does not exist`
+	if err := load(); err == nil || strings.ReplaceAll(err.Error(), path, "config.json") != want {
+		t.Errorf("load = %v; want %s", err, want)
+	}
+}
+
+func TestAppsWithoutName(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "apps-dir", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	isolateEnv(t)
+
+	dir := t.TempDir()
+	writeConfigFiles(dir, map[string]string{
+		"config.json": `{"port": 8000, "apps": {"dir": "/opt/apps", "serve": {"port": 8080}}}`,
+	})
+	AddConfigFile(filepath.Join(dir, "config.json"))
+	if err := load(); err != nil {
+		t.Fatalf("load without an app name failed: %v", err)
+	}
+	if IntValue("port") != 8000 {
+		t.Error("app section was applied without an app name")
+	}
+	if StringValue("apps-dir") != "/opt/apps" {
+		t.Error("flag under the apps key was not applied")
+	}
+}
+
+func TestAppsFlag(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "apps", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	SetAppName("serve")
+	isolateEnv(t)
+
+	dir := t.TempDir()
+	writeConfigFiles(dir, map[string]string{"config.json": `{"apps": ["serve", "fetch"]}`})
+	AddConfigFile(filepath.Join(dir, "config.json"))
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if apps := StringValues("apps"); len(apps) != 2 || apps[1] != "fetch" {
+		t.Errorf("apps is %v; expected [serve fetch]", apps)
+	}
+}
@@ -0,0 +1,361 @@
+package gears
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Config file formats
+const (
+	JSON   = "json"
+	JSONC  = "jsonc"
+	YAML   = "yaml"
+	TOML   = "toml"
+	INI    = "ini"
+	DOTENV = "env"
+)
+
+var builtinFormats = []string{JSON, JSONC, YAML, TOML, INI, DOTENV}
+
+var builtinExtensions = map[string]string{
+	".json":  JSON,
+	".jsonc": JSONC,
+	".json5": JSONC,
+	".yaml":  YAML,
+	".yml":   YAML,
+	".toml":  TOML,
+	".ini":   INI,
+	".env":   DOTENV,
+}
+
+// A ConfigParser reads a config file in a custom format. It returns the
+// value of each flag by flag name. Values follow the same type rules as
+// JSON, so they should be bools, numbers, strings or slices of them.
+type ConfigParser func(data []byte) (map[string]any, error)
+
+var configParsers = make(map[string]ConfigParser)
+var configExtensions = make(map[string]string)
+
+// A configEntry is a key read from a config file, with the position of the
+// key in the file. Typed formats convert values to JSON, so that they all
+// follow the same type rules. Untyped formats keep the text of the value,
+// which is parsed like an environment variable.
+type configEntry struct {
+	key string
+	// label is the key as written in the file, for messages, if it differs
+	// from key
+	label string
+	raw   json.RawMessage
+	text  *string
+	// env is set for text read from a .env file, which is parsed like the
+	// value of an environment variable
+	env bool
+	// section is set for a nested object or table without any keys, which
+	// sets nothing but still names a section, such as an empty profile
+	section bool
+	line    int
+	column  int
+}
+
+// configError creates an error at a position in the config file that is
+// currently being loaded. A line of 0 means the position is unknown.
+func configError(line int, column int, flag string, message string) *ConfigError {
+	err := newError(flag, message)
+	if line > 0 {
+		err.Location = fmt.Sprintf("%s:%d:%d", err.Location, line, column)
+	}
+	return err
+}
+
+// AddConfigFormat registers a parser for a custom config format. Config
+// files ending in one of the extensions, such as ".hcl", are read with it.
+func AddConfigFormat(format string, parser ConfigParser, extensions ...string) {
+	if slices.Contains(builtinFormats, format) {
+		log.Fatalf("Config format '%s' is built in and cannot be replaced!", format)
+	}
+	if parser == nil {
+		log.Fatalf("Config format '%s' must have a parser!", format)
+	}
+	configParsers[format] = parser
+	for _, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") {
+			log.Fatalf("Config file extension '%s' is invalid! Must start with a '.'.", ext)
+		}
+		configExtensions[strings.ToLower(ext)] = format
+	}
+}
+
+func assertValidFormat(format string) {
+	if _, exists := configParsers[format]; !exists && !slices.Contains(builtinFormats, format) {
+		log.Fatalf("Config format '%s' is invalid! Must be one of: %s, or added with AddConfigFormat.", format, strings.Join(builtinFormats, " "))
+	}
+}
+
+// formatOf returns the format of a config file, from its options or else
+// its extension. The format of files with other extensions is guessed from
+// their contents.
+func formatOf(file *configFile, data []byte) string {
+	if file.options.Format != "" {
+		return file.options.Format
+	}
+	ext := strings.ToLower(filepath.Ext(file.path))
+	if format, exists := configExtensions[ext]; exists {
+		return format
+	}
+	if format, exists := builtinExtensions[ext]; exists {
+		return format
+	}
+	return sniffFormat(data)
+}
+
+// sniffFormat guesses the format of a config file from its first line that
+// is not blank or a comment. Files that can't be recognized are read as
+// JSON.
+func sniffFormat(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "{") || strings.HasPrefix(line, "//") || strings.HasPrefix(line, "/*"):
+			return JSONC
+		case line == "---" || strings.HasPrefix(line, "- ") || isYamlKeyLine(line):
+			return YAML
+		case isDotEnvLine(line):
+			return DOTENV
+		case strings.HasPrefix(line, "[") || strings.Contains(line, "="):
+			// INI files are often valid TOML, and read the same way
+			if _, err := parseToml(data); err == nil {
+				return TOML
+			}
+			return INI
+		}
+		return JSON
+	}
+	return JSON
+}
+
+// isYamlKeyLine reports whether a line starts with a YAML key, like "port:".
+func isYamlKeyLine(line string) bool {
+	key, rest, found := strings.Cut(line, ":")
+	return found && key != "" && !strings.ContainsAny(key, " \t=\"'[{") && (rest == "" || rest[0] == ' ' || rest[0] == '\t')
+}
+
+// isDotEnvLine reports whether a line looks like an environment variable
+// assignment, like "PORT=80".
+func isDotEnvLine(line string) bool {
+	line = strings.TrimPrefix(line, "export ")
+	name, _, found := strings.Cut(line, "=")
+	if !found || name == "" || strings.ToUpper(name) != name {
+		return false
+	}
+	for i := range len(name) {
+		if !isDotEnvNameChar(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// readConfig reads the keys of a config file in the given format.
+func readConfig(format string, data []byte, options ConfigFileOptions) ([]configEntry, error) {
+	switch format {
+	case JSON:
+		return parseJson(data)
+	case JSONC:
+		return parseJson(stripJsonc(data))
+	case YAML:
+		return parseYaml(data)
+	case TOML:
+		return parseToml(data)
+	case INI:
+		return parseIni(data)
+	case DOTENV:
+		return parseDotEnvConfig(data, options.EnvPrefix)
+	}
+	return parseCustom(format, data)
+}
+
+// loadConfigFile reads a config file as a new layer, after the files it
+// includes. includedFrom is the chain of files that included it, outermost
+// first. The conditions of match blocks are checked against args and dotEnv.
+func loadConfigFile(file *configFile, includedFrom []string, args []string, dotEnv map[string]dotEnvValue) error {
+	policy := file.options.UnknownKeys
+	if policy == "" {
+		policy = unknownKeys
+	}
+
+	beginLayer("config", file.path)
+	currentSource.IncludedFrom = includedFrom
+
+	data, err := os.ReadFile(file.path)
+	if err != nil {
+		return newError("", fmt.Sprintf("Failed to read file: %s", err))
+	}
+	entries, err := readConfig(formatOf(file, data), data, file.options)
+	if err != nil {
+		return err
+	}
+
+	var errs ConfigErrors
+	entries, includes := splitIncludes(entries)
+	if len(includes) != 0 {
+		chain := append(slices.Clone(includedFrom), file.path)
+		for _, include := range includes {
+			paths, err := includePaths(file.path, include)
+			errs.collect(err)
+			for _, path := range paths {
+				if isIncluded(path, chain) {
+					errs = append(errs, configError(include.line, include.column, "", fmt.Sprintf("\"$include\": '%s' includes itself", path)))
+					continue
+				}
+				options := ConfigFileOptions{UnknownKeys: policy, EnvPrefix: file.options.EnvPrefix}
+				errs.collect(loadConfigFile(&configFile{path: path, options: options}, chain, args, dotEnv))
+			}
+			// Restore the including file's layer, so that it takes
+			// precedence over the files it includes
+			beginLayer("config", file.path)
+			currentSource.IncludedFrom = includedFrom
+		}
+	}
+
+	entries, err = splitProfiles(entries, policy)
+	errs.collect(err)
+	entries, matches := splitMatches(entries)
+	entries, app := splitApps(entries)
+	errs.collect(applyConfig(entries, policy))
+	if len(app) != 0 {
+		// This program's section takes precedence over the shared keys
+		beginLayer("config", file.path)
+		currentSource.IncludedFrom = includedFrom
+		currentSource.Block = "apps." + appName
+		errs.collect(applyConfig(app, policy))
+	}
+	for _, match := range matches {
+		errs.collect(applyMatches(match, policy, args, dotEnv))
+	}
+	return errs.err()
+}
+
+// parseCustom reads a config file with a parser added by AddConfigFormat.
+// Keys are sorted, since the parser gives no positions to order them by.
+func parseCustom(format string, data []byte) ([]configEntry, error) {
+	values, err := configParsers[format](data)
+	if err != nil {
+		var configErr *ConfigError
+		var configErrs ConfigErrors
+		if errors.As(err, &configErr) || errors.As(err, &configErrs) {
+			return nil, err
+		}
+		return nil, newError("", fmt.Sprintf("Invalid %s: %s", format, err))
+	}
+
+	var entries []configEntry
+	var errs ConfigErrors
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		raw, err := json.Marshal(values[key])
+		if err != nil {
+			errs = append(errs, newError(key, fmt.Sprintf("\"%s\": %s", key, err)))
+			continue
+		}
+		entries = append(entries, configEntry{key: key, raw: raw})
+	}
+	return entries, errs.err()
+}
+
+// configFlagName maps a config file key to a flag name. Keys of nested
+// objects are joined with dots, and dots become dashes, so that
+// "server.port" sets the server-port flag.
+func configFlagName(key string) string {
+	return strings.ReplaceAll(key, ".", "-")
+}
+
+// isNestedConfig reports whether an object in a config file holds more
+// keys, rather than being the value of a flag or a special key.
+func isNestedConfig(key string) bool {
+	if strings.HasPrefix(key, "$") {
+		return false
+	}
+	_, exists := flags[configFlagName(key)]
+	return !exists
+}
+
+// applyConfig sets the value of each flag in entries. Keys that are not
+// flags are handled according to the unknownKeys policy.
+func applyConfig(entries []configEntry, unknownKeys string) error {
+	var errs ConfigErrors
+	for _, entry := range entries {
+		if entry.section {
+			continue
+		}
+		name := configFlagName(entry.key)
+		label := entry.key
+		if entry.label != "" {
+			label = entry.label
+		}
+		flag, exists := flags[name]
+		if !exists {
+			// Keys like "$schema" and "$comment" are for editors and people
+			if strings.HasPrefix(entry.key, "$") || unknownKeys == "ignore" {
+				continue
+			}
+			err := configError(entry.line, entry.column, name, fmt.Sprintf("\"%s\": option does not exist", label))
+			if unknownKeys == "warn" {
+				log.Printf("Warning: %s\n", err)
+			} else {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		var err error
+		if entry.text != nil {
+			err = setTextValue(flag, *entry.text, entry.env)
+		} else {
+			err = setJsonValue(flag, entry.raw)
+		}
+		if err != nil {
+			errs = append(errs, configError(entry.line, entry.column, name, fmt.Sprintf("\"%s\": %s", label, err)))
+		}
+	}
+
+	return errs.err()
+}
+
+// setTextValue sets a flag from the text of an untyped config value. Values
+// are parsed like environment variables, except that bool flags accept
+// true, false and the like, with an empty value meaning true. Each value
+// adds one element to a list flag without a delimiter, unless it is from a
+// .env file, where it must be a JSON array as in the environment.
+func setTextValue(flag *Flag, text string, env bool) error {
+	switch flag.ValueType {
+	case "bool":
+		if text == "" {
+			return storeScalar(flag, true)
+		}
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("Value for '%s' must be a bool!", flag.Name)
+		}
+		return storeScalar(flag, value)
+	case "floats", "ints", "strings":
+		if env {
+			return setListText(flag, text)
+		}
+		if flag.EnvVarDelimiter != "" {
+			items, err := splitEnvList(text, flag.EnvVarDelimiter)
+			if err != nil {
+				return fmt.Errorf("Value for '%s' is invalid: %s!", flag.Name, err)
+			}
+			return setStringValues(flag.Name, items)
+		}
+	}
+	return setStringValue(flag.Name, text)
+}
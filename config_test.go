@@ -0,0 +1,143 @@
+package gears
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadConfigData loads data as a config file named name, the way Load reads
+// config files. The file is written to a temporary working directory, so
+// errors are reported at name.
+func loadConfigData(t *testing.T, name string, format string, data []byte, unknownKeys string) error {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		log.Fatal("Failed to write config: ", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		log.Fatal(err)
+	}
+
+	options := ConfigFileOptions{Format: format, UnknownKeys: unknownKeys}
+	return loadConfigFile(&configFile{path: name, options: options}, nil, nil, nil)
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		file *configFile
+		want string
+	}{
+		{&configFile{path: "config.json"}, JSON},
+		{&configFile{path: "config.jsonc"}, JSONC},
+		{&configFile{path: "config.json5"}, JSONC},
+		{&configFile{path: "config.yaml"}, YAML},
+		{&configFile{path: "config.YML"}, YAML},
+		{&configFile{path: "config.toml"}, TOML},
+		{&configFile{path: "config.ini"}, INI},
+		{&configFile{path: ".env"}, DOTENV},
+		{&configFile{path: "config.hcl"}, "hcl"},
+		{&configFile{path: "config"}, JSON},
+		{&configFile{path: "config", options: ConfigFileOptions{Format: YAML}}, YAML},
+		{&configFile{path: "config.json", options: ConfigFileOptions{Format: JSONC}}, JSONC},
+	}
+	tests_reset()
+	AddConfigFormat("hcl", func(data []byte) (map[string]any, error) { return nil, nil }, ".hcl")
+	for _, test := range tests {
+		if got := formatOf(test.file, nil); got != test.want {
+			t.Errorf("formatOf(%s) = %s; want %s", test.file.path, got, test.want)
+		}
+	}
+}
+
+func TestSniffFormat(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"", JSON},
+		{"{\"port\": 80}", JSONC},
+		{"// comment\n{\"port\": 80}", JSONC},
+		{"# comment\nport: 80\n", YAML},
+		{"---\nport: 80\n", YAML},
+		{"PORT=80\n", DOTENV},
+		{"export PORT=80\n", DOTENV},
+		{"port = 80\n[server]\nname = \"web\"\n", TOML},
+		{"; comment\nport = 80\n[server]\nname = web\n", INI},
+		{"port 80\n", JSON},
+	}
+	for _, test := range tests {
+		if got := sniffFormat([]byte(test.config)); got != test.want {
+			t.Errorf("sniffFormat(%q) = %s; want %s", test.config, got, test.want)
+		}
+	}
+}
+
+func TestCustomFormat(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	AddConfigFormat("custom", func(data []byte) (map[string]any, error) {
+		if string(data) == "bad" {
+			return nil, errors.New("bad data")
+		}
+		return map[string]any{"port": 8080, "tags": []string{"a", "b"}}, nil
+	}, ".custom")
+	if err := loadConfigData(t, "config.custom", "custom", []byte("good"), "error"); err != nil {
+		t.Errorf("loadConfigData(custom) failed: %v", err)
+	}
+	if IntValue("port") != 8080 {
+		t.Error("port was not set from custom format")
+	}
+	if tags := StringValues("tags"); len(tags) != 2 || tags[1] != "b" {
+		t.Errorf("tags is %v; expected [a b]", tags)
+	}
+	if err := loadConfigData(t, "config.custom", "custom", []byte("bad"), "error"); err == nil || err.Error() != "config.custom: Invalid custom: bad data" {
+		t.Errorf("loadConfigData(custom) = %v; want config.custom: Invalid custom: bad data", err)
+	}
+}
+
+func TestDotEnvConfig(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "hello-name", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "verbose", ValueType: "bool"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadConfigData(t, "app.env", DOTENV, []byte("HELLO_NAME=gears\nVERBOSE=true\nTAGS=[\"a\", \"b\"]\n"), "error"); err != nil {
+		t.Errorf("loadConfigData(env) failed: %v", err)
+	}
+	if StringValue("hello-name") != "gears" || !BoolValue("verbose") {
+		t.Error("flags were not set from .env config file")
+	}
+	if tags := StringValues("tags"); len(tags) != 2 || tags[1] != "b" {
+		t.Errorf("tags is %v; expected [a b] from JSON array", tags)
+	}
+	if err := loadConfigData(t, "app.env", DOTENV, []byte("VERBOSE=false\n"), "error"); err != nil || BoolValue("verbose") {
+		t.Errorf("VERBOSE=false in .env config file set verbose to %v: %v", BoolValue("verbose"), err)
+	}
+	err := loadConfigData(t, "app.env", DOTENV, []byte("TAGS=a\n"), "error")
+	if want := `app.env:1:1: "tags": Value for 'tags' must be a JSON array like ["a","b"], since the flag has no EnvVarDelimiter!`; err == nil || err.Error() != want {
+		t.Errorf("loadConfigData(env) = %v; want %s", err, want)
+	}
+	err = loadConfigData(t, "app.env", DOTENV, []byte("HELLO_NAME=gears\nOTHER=1\n"), "error")
+	if err == nil || err.Error() != `app.env:2:1: "OTHER": option does not exist` {
+		t.Errorf("loadConfigData(env) = %v; want app.env:2:1: \"OTHER\": option does not exist", err)
+	}
+}
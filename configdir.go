@@ -0,0 +1,63 @@
+package gears
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Files left behind by editors and package managers
+var backupSuffixes = []string{"~", ".bak", ".swp", ".swo", ".tmp", ".orig", ".rej", ".dpkg-old", ".dpkg-new", ".dpkg-dist", ".rpmnew", ".rpmsave"}
+
+func isBackupFile(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "#") {
+		return true
+	}
+	for _, suffix := range backupSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddConfigDir adds the files in a directory, such as /etc/app/conf.d, whose
+// names match a pattern like "*.json". An empty pattern matches every file.
+// Files are added in lexical order, so that later files take precedence.
+// Directories, hidden files and editor backup files are skipped.
+func AddConfigDir(dir string, pattern string) {
+	AddConfigDirWithOptions(dir, pattern, ConfigFileOptions{})
+}
+
+func AddConfigDirWithOptions(dir string, pattern string, options ConfigFileOptions) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		log.Fatalf("Config file pattern '%s' is invalid! %s", pattern, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Could not read config directory: %s\n", err)
+		}
+		return
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || isBackupFile(name) {
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, name); pattern != "" && !matched {
+			continue
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		AddConfigFileWithOptions(filepath.Join(dir, name), options)
+	}
+}
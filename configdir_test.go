@@ -0,0 +1,63 @@
+package gears
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddConfigDir(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "hello-name", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	isolateEnv(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"50-site.json":     `{"port": 8080}`,
+		"10-base.json":     `{"port": 80, "hello-name": "base"}`,
+		"60-local.json~":   `{"port": 1}`,
+		".70-hidden.json":  `{"port": 2}`,
+		"80-old.json.bak":  `{"port": 3}`,
+		"90-notes.txt":     `not config`,
+		"#99-lock.json#":   `{"port": 4}`,
+		"55-site.json.swp": `{"port": 5}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "20-subdir.json"), 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	AddConfigDir(dir, "*.json")
+	AddConfigDir(filepath.Join(dir, "missing"), "*.json")
+
+	expected := []string{"10-base.json", "50-site.json"}
+	if len(configFiles) != len(expected) {
+		t.Fatalf("AddConfigDir added %d files; expected %d", len(configFiles), len(expected))
+	}
+	for i, name := range expected {
+		if configFiles[i].path != filepath.Join(dir, name) {
+			t.Errorf("config file %d is %s; expected %s", i, configFiles[i].path, name)
+		}
+	}
+
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if IntValue("port") != 8080 || StringValue("hello-name") != "base" {
+		t.Error("config directory files were not loaded in lexical order")
+	}
+	if source := SourceOf("port"); source.Location != filepath.Join(dir, "50-site.json") {
+		t.Errorf("port has source %v; expected 50-site.json", source)
+	}
+}
@@ -0,0 +1,240 @@
+package gears
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+var dotEnvFiles []string
+
+// AddDotEnvFile adds a .env file of KEY=value lines. Its variables are read
+// along with the real environment, which takes precedence over them. Later
+// files take precedence over earlier ones. Missing files are skipped.
+func AddDotEnvFile(path string) {
+	dotEnvFiles = append(dotEnvFiles, path)
+}
+
+type dotEnvValue struct {
+	value string
+	// location is the file and line the variable was set on
+	location string
+	line     int
+}
+
+// loadDotEnvFiles reads every .env file that exists.
+func loadDotEnvFiles() (map[string]dotEnvValue, error) {
+	var errs ConfigErrors
+	vars := make(map[string]dotEnvValue)
+	for _, path := range dotEnvFiles {
+		if !fileExists(path) {
+			continue
+		}
+		beginLayer("env", path)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs.collect(fmt.Errorf("Failed to read file: %s", err))
+			continue
+		}
+		errs.collect(parseDotEnv(path, data, vars))
+	}
+	return vars, errs.err()
+}
+
+// lookupEnv looks up an environment variable, falling back to the
+// variables read from .env files. It returns the location the value was
+// found at.
+func lookupEnv(name string, dotEnv map[string]dotEnvValue) (string, string, bool) {
+	if value, exists := os.LookupEnv(name); exists {
+		return value, name, true
+	}
+	if v, exists := dotEnv[name]; exists {
+		return v.value, v.location, true
+	}
+	return "", "", false
+}
+
+// fromDotEnv reports whether a location returned by lookupEnv is a line of
+// a .env file, rather than a variable in the real environment.
+func fromDotEnv(location string, dotEnv map[string]dotEnvValue) bool {
+	for _, v := range dotEnv {
+		if v.location == location {
+			return true
+		}
+	}
+	return false
+}
+
+func isDotEnvNameChar(c byte, first bool) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || !first && (c >= '0' && c <= '9' || c == '.')
+}
+
+// parseDotEnv reads the variables of a .env file into vars. Values may be
+// unquoted, single quoted (taken literally) or double quoted (with escapes),
+// and quoted values may span several lines. ${VAR} and $VAR are expanded in
+// unquoted and double quoted values, from the environment and then the
+// variables set so far.
+func parseDotEnv(path string, data []byte, vars map[string]dotEnvValue) error {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	fail := func(offset int, message string) error {
+		line, column := position([]byte(text), int64(offset))
+		return configError(line, column, "", "Invalid .env file: "+message)
+	}
+	lookup := func(name string) string {
+		// The real environment wins over .env files here too
+		value, _, _ := lookupEnv(name, vars)
+		return value
+	}
+
+	pos := 0
+	skipSpace := func() {
+		for pos < len(text) && (text[pos] == ' ' || text[pos] == '\t') {
+			pos++
+		}
+	}
+	skipLine := func() {
+		for pos < len(text) && text[pos] != '\n' {
+			pos++
+		}
+		pos++
+	}
+
+	for pos < len(text) {
+		skipSpace()
+		if pos >= len(text) || text[pos] == '\n' || text[pos] == '#' {
+			skipLine()
+			continue
+		}
+
+		start := pos
+		if strings.HasPrefix(text[pos:], "export ") {
+			pos += len("export ")
+			skipSpace()
+		}
+		nameStart := pos
+		for pos < len(text) && isDotEnvNameChar(text[pos], pos == nameStart) {
+			pos++
+		}
+		name := text[nameStart:pos]
+		if name == "" {
+			return fail(nameStart, "expected a variable name")
+		}
+		skipSpace()
+		if pos >= len(text) || text[pos] != '=' {
+			return fail(pos, fmt.Sprintf("expected '=' after %s", name))
+		}
+		pos++
+		skipSpace()
+
+		var value string
+		if pos < len(text) && (text[pos] == '"' || text[pos] == '\'') {
+			quote := text[pos]
+			quoteStart := pos
+			pos++
+			var b strings.Builder
+			for ; pos < len(text) && text[pos] != quote; pos++ {
+				if quote == '"' && text[pos] == '\\' && pos+1 < len(text) {
+					pos++
+					switch text[pos] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					case 'r':
+						b.WriteByte('\r')
+					case '$':
+						// Escaped dollar signs are kept from being expanded
+						b.WriteString("$$")
+					default:
+						b.WriteByte(text[pos])
+					}
+					continue
+				}
+				if quote == '"' && text[pos] == '$' {
+					b.WriteByte('$')
+					continue
+				}
+				if quote == '\'' && text[pos] == '$' {
+					b.WriteString("$$")
+					continue
+				}
+				b.WriteByte(text[pos])
+			}
+			if pos >= len(text) {
+				return fail(quoteStart, "unterminated string")
+			}
+			pos++
+			value = b.String()
+
+			skipSpace()
+			if pos < len(text) && text[pos] != '\n' && text[pos] != '#' {
+				return fail(pos, "unexpected text after quoted value")
+			}
+		} else {
+			end := strings.IndexByte(text[pos:], '\n')
+			if end == -1 {
+				end = len(text) - pos
+			}
+			raw := text[pos : pos+end]
+			for i := 1; i < len(raw); i++ {
+				if raw[i] == '#' && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+					raw = raw[:i]
+					break
+				}
+			}
+			value = strings.ReplaceAll(strings.TrimSpace(raw), "$$", "$$$$")
+			pos += end
+		}
+		skipLine()
+
+		value = os.Expand(value, func(v string) string {
+			if v == "$" {
+				return "$"
+			}
+			name, fallback, hasFallback := strings.Cut(v, ":-")
+			if value := lookup(name); value != "" || !hasFallback {
+				return value
+			}
+			return fallback
+		})
+
+		line, _ := position([]byte(text), int64(start))
+		vars[name] = dotEnvValue{value: value, location: fmt.Sprintf("%s:%d", path, line), line: line}
+	}
+	return nil
+}
+
+// parseDotEnvConfig reads a .env file added as a config file. Variables are
+// matched to flags by their environment variable names, with the given
+// prefix if it is not empty.
+func parseDotEnvConfig(data []byte, prefix string) ([]configEntry, error) {
+	vars := make(map[string]dotEnvValue)
+	if err := parseDotEnv(currentSource.Location, data, vars); err != nil {
+		return nil, err
+	}
+
+	envVars := make(map[string]string)
+	for _, flag := range flags {
+		names := envVarsOf(flag)
+		if prefix != "" && !flag.NoEnv && len(flag.EnvVars) == 0 {
+			names = []string{prefixedEnvVar(prefix, flag.Name)}
+		}
+		for _, name := range append(names, legacyEnvVarsOf(flag)...) {
+			envVars[name] = flag.Name
+		}
+	}
+	var entries []configEntry
+	for name, v := range vars {
+		key := name
+		if flagName, exists := envVars[name]; exists {
+			key = flagName
+		}
+		entries = append(entries, configEntry{key: key, text: &v.value, env: true, line: v.line, column: 1})
+	}
+	slices.SortFunc(entries, func(a configEntry, b configEntry) int {
+		return a.line - b.line
+	})
+	return entries, nil
+}
@@ -0,0 +1,134 @@
+package gears
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	t.Setenv("GEARS_TEST_HOME", "/home/test")
+	t.Setenv("GEARS_TEST_USER", "real")
+
+	config := `# comment
+PLAIN=hello world # comment
+export EXPORTED=yes
+SPACED = value
+SINGLE='literal $PLAIN # not a comment'
+DOUBLE="line one\nline two \$PLAIN"
+MULTI="first
+second"
+EXPANDED=${PLAIN}!
+BRACELESS=$GEARS_TEST_HOME/bin
+FALLBACK=${MISSING:-default}
+EMPTY=
+TABBED=value	# comment
+HASH=a#b
+GEARS_TEST_USER=file
+GREETING=hi ${GEARS_TEST_USER}
+`
+	vars := make(map[string]dotEnvValue)
+	if err := parseDotEnv(".env", []byte(config), vars); err != nil {
+		t.Fatalf("parseDotEnv failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"PLAIN":           "hello world",
+		"EXPORTED":        "yes",
+		"SPACED":          "value",
+		"SINGLE":          "literal $PLAIN # not a comment",
+		"DOUBLE":          "line one\nline two $PLAIN",
+		"MULTI":           "first\nsecond",
+		"EXPANDED":        "hello world!",
+		"BRACELESS":       "/home/test/bin",
+		"FALLBACK":        "default",
+		"EMPTY":           "",
+		"TABBED":          "value",
+		"HASH":            "a#b",
+		"GEARS_TEST_USER": "file",
+		"GREETING":        "hi real",
+	}
+	if len(vars) != len(expected) {
+		t.Errorf("parseDotEnv returned %d variables; expected %d", len(vars), len(expected))
+	}
+	for name, want := range expected {
+		if vars[name].value != want {
+			t.Errorf("%s is %q; expected %q", name, vars[name].value, want)
+		}
+	}
+	if vars["EXPANDED"].location != ".env:9" {
+		t.Errorf("EXPANDED has location '%s'; expected '.env:9'", vars["EXPANDED"].location)
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"=value\n", `.env:1:1: Invalid .env file: expected a variable name`},
+		{"NAME value\n", `.env:1:6: Invalid .env file: expected '=' after NAME`},
+		{"NAME=\"value\n", `.env:1:6: Invalid .env file: unterminated string`},
+		{"NAME='a' b\n", `.env:1:10: Invalid .env file: unexpected text after quoted value`},
+	}
+	for _, test := range tests {
+		beginLayer("env", ".env")
+		err := parseDotEnv(".env", []byte(test.config), make(map[string]dotEnvValue))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("parseDotEnv(%q) = %v; want %s", test.config, err, test.want)
+		}
+	}
+}
+
+func TestLoadDotEnv(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "dotenv-name", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "dotenv-tags", ValueType: "strings", DefaultValue: []string{}, EnvVarDelimiter: ","}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "dotenv-port", ValueType: "int", DefaultValue: 0}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "dotenv-verbose", ValueType: "bool"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "dotenv-debug", ValueType: "bool"}); err != nil {
+		log.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	if err := os.WriteFile(path, []byte("DOTENV_NAME=file\nDOTENV_TAGS=a,b\nDOTENV_PORT=80\nDOTENV_VERBOSE=false\n"), 0644); err != nil {
+		log.Fatal("Failed to write .env: ", err)
+	}
+	AddDotEnvFile(path)
+	AddDotEnvFile(filepath.Join(dir, "missing.env"))
+	isolateEnv(t)
+	t.Setenv("DOTENV_PORT", "8080")
+	t.Setenv("DOTENV_DEBUG", "false")
+
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if StringValue("dotenv-name") != "file" {
+		t.Error("dotenv-name was not set from .env file")
+	}
+	if tags := StringValues("dotenv-tags"); len(tags) != 2 || tags[1] != "b" {
+		t.Errorf("dotenv-tags is %v; expected [a b]", tags)
+	}
+	if IntValue("dotenv-port") != 8080 {
+		t.Error("real environment variable did not take precedence over .env file")
+	}
+	if BoolValue("dotenv-verbose") {
+		t.Error("dotenv-verbose was set by false in .env file")
+	}
+	if !BoolValue("dotenv-debug") {
+		t.Error("dotenv-debug was not set by a value in the real environment")
+	}
+	if source := SourceOf("dotenv-name"); source.Kind != "env" || !strings.HasSuffix(source.Location, ".env:1") {
+		t.Errorf("dotenv-name has source %v; expected env from .env:1", source)
+	}
+}
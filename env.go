@@ -0,0 +1,203 @@
+package gears
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+var envPrefix string
+var legacyEnvPrefixes []string
+
+func assertValidEnvPrefix(prefix string) {
+	if !regexp.MustCompile(`^([A-Z][A-Z0-9_]*)?$`).MatchString(prefix) {
+		log.Fatalf("Environment variable prefix '%s' is invalid! Must only contain uppercase letters, numbers and '_'.", prefix)
+	}
+}
+
+// SetEnvPrefix sets the prefix of the environment variables flags are read
+// from, so that the port flag is read from MYAPP_PORT instead of PORT.
+// Variables with one of the legacy prefixes are still read, with a warning,
+// when the new variable is not set. An empty legacy prefix reads the
+// unprefixed variables.
+func SetEnvPrefix(prefix string, legacy ...string) {
+	assertValidEnvPrefix(prefix)
+	for _, legacyPrefix := range legacy {
+		assertValidEnvPrefix(legacyPrefix)
+	}
+	envPrefix = prefix
+	legacyEnvPrefixes = legacy
+}
+
+func prefixedEnvVar(prefix string, name string) string {
+	if prefix == "" {
+		return toEnvVar(name)
+	}
+	return prefix + "_" + toEnvVar(name)
+}
+
+// envVarsOf returns the names of the environment variables a flag is read
+// from, in the order they are checked.
+func envVarsOf(flag *Flag) []string {
+	if flag.NoEnv {
+		return nil
+	}
+	if len(flag.EnvVars) != 0 {
+		return flag.EnvVars
+	}
+	return []string{prefixedEnvVar(envPrefix, flag.Name)}
+}
+
+// readsEnv reports whether a flag is read from the environment.
+func readsEnv(flag *Flag) bool {
+	return len(envVarsOf(flag)) != 0
+}
+
+// envVarsUsage describes the environment variables of a flag for usage
+// output, like "$EDITOR, $VISUAL".
+func envVarsUsage(flag *Flag) string {
+	var names []string
+	for _, name := range envVarsOf(flag) {
+		names = append(names, "$"+name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// legacyEnvVarsOf returns the deprecated environment variables a flag is
+// read from, with the legacy prefixes set with SetEnvPrefix.
+func legacyEnvVarsOf(flag *Flag) []string {
+	if flag.NoEnv || len(flag.EnvVars) != 0 {
+		return nil
+	}
+	var names []string
+	for _, prefix := range legacyEnvPrefixes {
+		names = append(names, prefixedEnvVar(prefix, flag.Name))
+	}
+	return names
+}
+
+// lookupFlagEnv looks up the environment variables of a flag, falling back
+// to those with a legacy prefix. It returns the value and the location it
+// was found at. Unless quiet, a variable with a legacy prefix prints a
+// deprecation warning.
+func lookupFlagEnv(flag *Flag, dotEnv map[string]dotEnvValue, quiet bool) (string, string, bool) {
+	names := envVarsOf(flag)
+	for _, name := range names {
+		if value, location, exists := lookupEnv(name, dotEnv); exists {
+			return value, location, true
+		}
+	}
+	for _, name := range legacyEnvVarsOf(flag) {
+		if value, location, exists := lookupEnv(name, dotEnv); exists {
+			if !quiet {
+				log.Printf("Warning: %s is deprecated, use %s instead\n", name, names[0])
+			}
+			return value, location, true
+		}
+	}
+	return "", "", false
+}
+
+func isListFlag(flag *Flag) bool {
+	return flag.ValueType == "floats" || flag.ValueType == "ints" || flag.ValueType == "strings"
+}
+
+// splitEnvList splits the value of a list on the flag's delimiter. To
+// contain the delimiter, an element may be double quoted, or the delimiter
+// may be escaped with a backslash, as may quotes and backslashes.
+func splitEnvList(value string, delimiter string) ([]string, error) {
+	var items []string
+	var b strings.Builder
+	quoted := false
+	elementStart := true
+	for i := 0; i < len(value); {
+		switch {
+		case value[i] == '\\' && strings.HasPrefix(value[i+1:], delimiter):
+			b.WriteString(delimiter)
+			i += 1 + len(delimiter)
+		case value[i] == '\\' && i+1 < len(value) && (value[i+1] == '\\' || value[i+1] == '"'):
+			b.WriteByte(value[i+1])
+			i += 2
+		case value[i] == '"' && (quoted || elementStart):
+			quoted = !quoted
+			i++
+		case !quoted && strings.HasPrefix(value[i:], delimiter):
+			items = append(items, b.String())
+			b.Reset()
+			elementStart = true
+			i += len(delimiter)
+			continue
+		default:
+			b.WriteByte(value[i])
+			i++
+		}
+		elementStart = false
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	return append(items, b.String()), nil
+}
+
+// setListText sets a list flag from a single text value, such as an
+// environment variable. With an EnvVarDelimiter, the value is split on it.
+// Without one, the value must be a JSON array.
+func setListText(flag *Flag, value string) error {
+	if flag.EnvVarDelimiter != "" {
+		items, err := splitEnvList(value, flag.EnvVarDelimiter)
+		if err != nil {
+			return fmt.Errorf("Value for '%s' is invalid: %s!", flag.Name, err)
+		}
+		return setStringValues(flag.Name, items)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		return fmt.Errorf("Value for '%s' must be a JSON array like [\"a\",\"b\"], since the flag has no EnvVarDelimiter!", flag.Name)
+	}
+	if !json.Valid([]byte(value)) {
+		return fmt.Errorf("Value for '%s' is not a valid JSON array!", flag.Name)
+	}
+	err := setJsonValue(flag, json.RawMessage(value))
+	var typeErr *jsonTypeErr
+	if errors.As(err, &typeErr) {
+		if typeErr.index >= 0 {
+			return fmt.Errorf("Value for '%s' must be a JSON %s, got %s at index %d!", flag.Name, typeErr.expected, typeErr.kind, typeErr.index)
+		}
+		return fmt.Errorf("Value for '%s' must be a JSON %s, got %s!", flag.Name, typeErr.expected, typeErr.kind)
+	}
+	return err
+}
+
+// loadListEnv reads a list flag from the environment, as parsed by
+// setListText. When the flag's variable is not set, indexed variables like
+// TAGS_0, TAGS_1 and so on are read instead.
+func loadListEnv(flag *Flag, dotEnv map[string]dotEnvValue, quiet bool) error {
+	if value, location, exists := lookupFlagEnv(flag, dotEnv, quiet); exists {
+		currentSource.Location = location
+		return setListText(flag, value)
+	}
+
+	names := envVarsOf(flag)
+	for i, name := range append(names, legacyEnvVarsOf(flag)...) {
+		var items []string
+		for n := 0; ; n++ {
+			value, location, exists := lookupEnv(fmt.Sprintf("%s_%d", name, n), dotEnv)
+			if !exists {
+				break
+			}
+			if n == 0 {
+				currentSource.Location = location
+			}
+			items = append(items, value)
+		}
+		if len(items) != 0 {
+			if i >= len(names) && !quiet {
+				log.Printf("Warning: %s_0... is deprecated, use %s_0... instead\n", name, names[0])
+			}
+			return setStringValues(flag.Name, items)
+		}
+	}
+	return nil
+}
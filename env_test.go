@@ -0,0 +1,214 @@
+package gears
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnvPrefix(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80, Description: "Port"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "hello-name", ValueType: "string", DefaultValue: "", Description: "Name"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "timeout", ValueType: "int", DefaultValue: 0, Description: "Timeout"}); err != nil {
+		log.Fatal(err)
+	}
+	SetEnvPrefix("MYAPP", "OLDAPP", "")
+	isolateEnv(t)
+
+	t.Setenv("PORT", "1")
+	t.Setenv("MYAPP_PORT", "8080")
+	t.Setenv("OLDAPP_HELLO_NAME", "legacy")
+	t.Setenv("TIMEOUT", "30")
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if n := strings.Count(logs.String(), "OLDAPP_HELLO_NAME is deprecated"); n != 1 {
+		t.Errorf("deprecation warning was printed %d times; expected once:\n%s", n, logs.String())
+	}
+	if IntValue("port") != 8080 {
+		t.Error("prefixed variable did not take precedence")
+	}
+	if StringValue("hello-name") != "legacy" {
+		t.Error("variable with legacy prefix was not read")
+	}
+	if IntValue("timeout") != 30 {
+		t.Error("unprefixed legacy variable was not read")
+	}
+	if source := SourceOf("hello-name"); source.Location != "OLDAPP_HELLO_NAME" {
+		t.Errorf("hello-name has source %v; expected env OLDAPP_HELLO_NAME", source)
+	}
+
+	var w bytes.Buffer
+	FprintUsage(&w)
+	if !strings.Contains(w.String(), "--port ($MYAPP_PORT)\n") {
+		t.Errorf("usage does not show prefixed variable:\n%s", w.String())
+	}
+}
+
+func TestDotEnvConfigPrefix(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "editor", ValueType: "string", DefaultValue: "", EnvVars: []string{"EDITOR"}}); err != nil {
+		log.Fatal(err)
+	}
+	SetEnvPrefix("MYAPP")
+	isolateEnv(t)
+
+	dir := t.TempDir()
+	writeConfigFiles(dir, map[string]string{"app.env": "SHARED_PORT=8080\nEDITOR=vi\n"})
+	AddConfigFileWithOptions(filepath.Join(dir, "app.env"), ConfigFileOptions{EnvPrefix: "SHARED"})
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if IntValue("port") != 8080 {
+		t.Error("variable with the file's prefix was not read")
+	}
+	if StringValue("editor") != "vi" {
+		t.Error("flag with its own variables was not read")
+	}
+}
+
+func TestEnvVars(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "editor", ValueType: "string", DefaultValue: "vi", Description: "Editor", EnvVars: []string{"MYAPP_EDITOR", "VISUAL", "EDITOR"}}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "no-color", ValueType: "bool", Description: "No color", EnvVars: []string{"NO_COLOR"}}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "secret", ValueType: "string", DefaultValue: "", Description: "Secret", NoEnv: true}); err != nil {
+		log.Fatal(err)
+	}
+	SetEnvPrefix("MYAPP", "")
+	isolateEnv(t)
+
+	t.Setenv("VISUAL", "code")
+	t.Setenv("EDITOR", "nano")
+	t.Setenv("NO_COLOR", "1")
+	t.Setenv("SECRET", "leaked")
+	t.Setenv("MYAPP_SECRET", "leaked")
+
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if StringValue("editor") != "code" {
+		t.Error("environment variables were not checked in order")
+	}
+	if !BoolValue("no-color") {
+		t.Error("flag was not read from its environment variable")
+	}
+	if StringValue("secret") != "" {
+		t.Error("flag with NoEnv was read from the environment")
+	}
+
+	var w bytes.Buffer
+	FprintUsage(&w)
+	usage := w.String()
+	if !strings.Contains(usage, "--editor ($MYAPP_EDITOR, $VISUAL, $EDITOR)\n") || !strings.Contains(usage, "--secret\n") {
+		t.Errorf("usage does not show effective environment variables:\n%s", usage)
+	}
+
+	if err := Add(&Flag{Name: "bad", ValueType: "bool", EnvVars: []string{"NOT-VALID"}}); err == nil {
+		t.Error("flag with invalid environment variable was added")
+	}
+	if err := Add(&Flag{Name: "both", ValueType: "bool", EnvVars: []string{"BOTH"}, NoEnv: true}); err == nil {
+		t.Error("flag with both EnvVars and NoEnv was added")
+	}
+}
+
+func TestSplitEnvList(t *testing.T) {
+	tests := []struct {
+		value     string
+		delimiter string
+		want      []string
+	}{
+		{"a,b,c", ",", []string{"a", "b", "c"}},
+		{`a\,b,c`, ",", []string{"a,b", "c"}},
+		{`"a,b",c`, ",", []string{"a,b", "c"}},
+		{`say "hi",c`, ",", []string{`say "hi"`, "c"}},
+		{`C:\dir;D:\dir`, ";", []string{`C:\dir`, `D:\dir`}},
+		{`a\\,b`, ",", []string{`a\`, "b"}},
+		{"a::b::c", "::", []string{"a", "b", "c"}},
+		{"", ",", []string{""}},
+	}
+	for _, test := range tests {
+		got, err := splitEnvList(test.value, test.delimiter)
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("splitEnvList(%q, %q) = %q, %v; want %q", test.value, test.delimiter, got, err, test.want)
+		}
+	}
+	if _, err := splitEnvList(`"a,b`, ","); err == nil {
+		t.Error("splitEnvList succeeded with an unterminated quote; expected failure")
+	}
+}
+
+func TestListEnv(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: []string{"default"}}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "ports", ValueType: "ints", DefaultValue: []int{}}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "ratios", ValueType: "floats", DefaultValue: []float64{}, EnvVarDelimiter: ","}); err != nil {
+		log.Fatal(err)
+	}
+	isolateEnv(t)
+
+	t.Setenv("TAGS", `["a", "b"]`)
+	t.Setenv("PORTS_0", "80")
+	t.Setenv("PORTS_1", "443")
+	t.Setenv("PORTS_3", "1")
+	t.Setenv("RATIOS_0", "1")
+
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if tags := StringValues("tags"); !slices.Equal(tags, []string{"a", "b"}) {
+		t.Errorf("tags is %v; expected [a b] from JSON array", tags)
+	}
+	if ports := IntValues("ports"); !slices.Equal(ports, []int{80, 443}) {
+		t.Errorf("ports is %v; expected [80 443] from indexed variables", ports)
+	}
+	if ratios := FloatValues("ratios"); !slices.Equal(ratios, []float64{1}) {
+		t.Errorf("ratios is %v; expected [1] from indexed variables", ratios)
+	}
+	if source := SourceOf("ports"); source.Location != "PORTS_0" {
+		t.Errorf("ports has source %v; expected env PORTS_0", source)
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"a,b", `TAGS: Value for 'tags' must be a JSON array like ["a","b"], since the flag has no EnvVarDelimiter!`},
+		{`["a",`, `TAGS: Value for 'tags' is not a valid JSON array!`},
+		{`["a", 1]`, `TAGS: Value for 'tags' must be a JSON array of strings, got int at index 1!`},
+	}
+	for _, test := range tests {
+		t.Setenv("TAGS", test.value)
+		err := load()
+		if err == nil || err.Error() != test.want {
+			t.Errorf("load with TAGS=%s = %v; want %s", test.value, err, test.want)
+		}
+	}
+}
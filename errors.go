@@ -0,0 +1,86 @@
+package gears
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// A ConfigError is a single problem found while loading flags.
+type ConfigError struct {
+	// Flag is the name of the flag the error is about, if any
+	Flag string `json:"flag,omitempty"`
+	// Source is one of: config env args validation
+	Source string `json:"source"`
+	// Location is the config file, environment variable or argument that
+	// caused the error, if any
+	Location string `json:"location,omitempty"`
+	// IncludedFrom is the chain of config files that included the config
+	// file, outermost first
+	IncludedFrom []string `json:"includedFrom,omitempty"`
+	Message      string   `json:"message"`
+}
+
+func (e *ConfigError) Error() string {
+	message := e.Message
+	if len(e.IncludedFrom) != 0 {
+		message += " (included from " + strings.Join(e.IncludedFrom, " > ") + ")"
+	}
+	if e.Location == "" {
+		return message
+	}
+	return e.Location + ": " + message
+}
+
+// ConfigErrors holds every problem found while loading flags, in the order
+// they were found.
+type ConfigErrors []*ConfigError
+
+func (errs ConfigErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// JSON returns the errors as an indented JSON array.
+func (errs ConfigErrors) JSON() string {
+	data, _ := json.MarshalIndent(errs, "", "  ")
+	return string(data)
+}
+
+// newError creates an error for the layer that is currently being loaded.
+func newError(flag string, message string) *ConfigError {
+	return &ConfigError{
+		Flag:         flag,
+		Source:       currentSource.Kind,
+		Location:     currentSource.Location,
+		IncludedFrom: currentSource.IncludedFrom,
+		Message:      message,
+	}
+}
+
+// collect adds err to errs, flattening any ConfigErrors it contains.
+func (errs *ConfigErrors) collect(err error) {
+	if err == nil {
+		return
+	}
+	var many ConfigErrors
+	var one *ConfigError
+	if errors.As(err, &many) {
+		*errs = append(*errs, many...)
+	} else if errors.As(err, &one) {
+		*errs = append(*errs, one)
+	} else {
+		*errs = append(*errs, newError("", err.Error()))
+	}
+}
+
+// err returns errs as an error, or nil if there are none.
+func (errs ConfigErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
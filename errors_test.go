@@ -0,0 +1,84 @@
+package gears
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadErrors(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "host", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "retries", ValueType: "int", DefaultValue: 0}); err != nil {
+		log.Fatal(err)
+	}
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"port":"80","hots":"example.com"}`), 0644); err != nil {
+		log.Fatal("Failed to write config: ", err)
+	}
+	AddConfigFile(configPath)
+	isolateEnv(t)
+	t.Setenv("RETRIES", "many")
+
+	err := load("cmd", "--unknown")
+	var errs ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("load returned %v; expected ConfigErrors", err)
+	}
+	if len(errs) != 4 {
+		t.Fatalf("load returned %d errors; expected 4:\n%s", len(errs), errs)
+	}
+
+	found := map[string]bool{}
+	for _, e := range errs {
+		found[e.Source+" "+e.Flag] = true
+	}
+	for _, want := range []string{"config port", "config hots", "env retries", "args "} {
+		if !found[want] {
+			t.Errorf("missing error for '%s':\n%s", want, errs)
+		}
+	}
+
+	var decoded []map[string]string
+	if err := json.Unmarshal([]byte(errs.JSON()), &decoded); err != nil || len(decoded) != 4 {
+		t.Errorf("errors could not be printed as JSON: %s", errs.JSON())
+	}
+	if !strings.HasPrefix(decoded[0]["location"], configPath+":1:") {
+		t.Errorf("config error has location '%s'; expected '%s:1:...'", decoded[0]["location"], configPath)
+	}
+}
+
+func TestLoadErrorsOrder(t *testing.T) {
+	tests_reset()
+
+	for _, name := range []string{"gamma", "alpha", "beta"} {
+		if err := Add(&Flag{Name: name, ValueType: "int", DefaultValue: 0}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	isolateEnv(t)
+	t.Setenv("GAMMA", "x")
+	t.Setenv("ALPHA", "x")
+	t.Setenv("BETA", "x")
+
+	for range 10 {
+		var errs ConfigErrors
+		if !errors.As(load("cmd"), &errs) || len(errs) != 3 {
+			t.Fatalf("load returned %v; expected 3 errors", errs)
+		}
+		if errs[0].Flag != "alpha" || errs[1].Flag != "beta" || errs[2].Flag != "gamma" {
+			t.Fatalf("env errors are not in order of flag name:\n%s", errs)
+		}
+	}
+}
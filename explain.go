@@ -0,0 +1,53 @@
+package gears
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+func (s Source) String() string {
+	str := s.Kind
+	if s.Location != "" {
+		str += " " + s.Location
+	}
+	var details []string
+	if s.Block != "" {
+		details = append(details, s.Block)
+	}
+	if len(s.IncludedFrom) != 0 {
+		details = append(details, "included from "+strings.Join(s.IncludedFrom, " > "))
+	}
+	if len(details) != 0 {
+		str += " (" + strings.Join(details, ", ") + ")"
+	}
+	return str
+}
+
+// FprintExplain prints the value of every flag and where it was set, to
+// help users find out why a flag has the value it does.
+func FprintExplain(w io.Writer) {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		value := values[name]
+		if str, isString := value.(string); isString {
+			value = fmt.Sprintf("%q", str)
+		}
+		fmt.Fprintf(w, "--%s", name)
+		if readsEnv(flags[name]) {
+			fmt.Fprintf(w, " (%s)", envVarsUsage(flags[name]))
+		}
+		fmt.Fprintf(w, " = %v (from %s)\n", value, sources[name])
+	}
+}
+
+func PrintExplain() {
+	FprintExplain(os.Stdout)
+}
@@ -0,0 +1,43 @@
+package gears
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFprintExplain(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "hello-name", ValueType: "string", DefaultValue: "world"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	isolateEnv(t)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"port": 8080}`), 0644); err != nil {
+		log.Fatal("Failed to write config: ", err)
+	}
+	AddConfigFile(path)
+	if err := load("program", "--tags", "a"); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	FprintExplain(&buf)
+	expected := `--hello-name ($HELLO_NAME) = "world" (from default)
+--port ($PORT) = 8080 (from config ` + path + `)
+--tags ($TAGS) = [a] (from args argument 2)
+`
+	if buf.String() != expected {
+		t.Errorf("FprintExplain printed:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
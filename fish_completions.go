@@ -1,6 +1,9 @@
 package gears
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 func FishCompletions(command string) string {
 	completions := ""
@@ -9,8 +12,18 @@ func FishCompletions(command string) string {
 		if flag.Shorthand != "" {
 			completion += fmt.Sprintf(` -s "%s"`, flag.Shorthand)
 		}
-		if flag.Description != "" {
-			completion += fmt.Sprintf(` -d "%s"`, flag.Description)
+		description := flag.Description
+		if readsEnv(flag) {
+			// Fish expands "$" in double quotes, so the names are left bare
+			env := "env: " + strings.Join(envVarsOf(flag), ", ")
+			if description == "" {
+				description = env
+			} else {
+				description += " (" + env + ")"
+			}
+		}
+		if description != "" {
+			completion += fmt.Sprintf(` -d "%s"`, description)
 		}
 		completions += completion + "\n"
 	}
@@ -20,9 +20,9 @@ func TestFishCompletions(t *testing.T) {
 	}
 
 	expectedLines := []string{
-		`complete -c "my-cmd" -l "my-str" -s "s" -d "My string description"`,
-		`complete -c "my-cmd" -l "my-bool" -s "b"`,
-		`complete -c "my-cmd" -l "my-floats"`,
+		`complete -c "my-cmd" -l "my-str" -s "s" -d "My string description (env: MY_STR)"`,
+		`complete -c "my-cmd" -l "my-bool" -s "b" -d "env: MY_BOOL"`,
+		`complete -c "my-cmd" -l "my-floats" -d "env: MY_FLOATS"`,
 	}
 
 	completions := FishCompletions("my-cmd")
@@ -3,10 +3,11 @@ package gears
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"maps"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -19,6 +20,31 @@ type Flag struct {
 	EnvVarDelimiter  string
 	Description      string
 	ExcludeFromUsage bool
+
+	// Repeat is what happens when the flag is set more than once in the
+	// same layer, as in "--port 80 --port 8080". For scalar flags, one of:
+	// last-wins first-wins error. Defaults to the policy set with
+	// SetRepeat. For list flags, one of: append replace. Defaults to
+	// append.
+	Repeat string
+
+	// Merge is how the values a list flag gets from one layer are combined
+	// with those from lower layers and its default. One of: replace append
+	// prepend union. Defaults to replace.
+	Merge string
+
+	// Validate is called with the flag's final value after all layers have
+	// been loaded. Returning an error marks the value as invalid.
+	Validate func(v any) error
+
+	// EnvVars are the environment variables the flag is read from, checked
+	// in order, such as HTTP_PROXY or EDITOR. They are used as-is, without
+	// the prefix set with SetEnvPrefix. Defaults to the flag's name in
+	// uppercase, with dashes replaced by underscores.
+	EnvVars []string
+
+	// NoEnv stops the flag from being read from the environment.
+	NoEnv bool
 }
 
 var flags map[string]*Flag
@@ -26,7 +52,152 @@ var shorthandNames map[string]string
 var values map[string]any
 var positionals []string
 
-var configFiles []string
+// ConfigFileOptions change how a single config file is read.
+type ConfigFileOptions struct {
+	// UnknownKeys is what to do with keys that are not flags. One of: error
+	// warn ignore. Defaults to the policy set with SetUnknownKeys.
+	UnknownKeys string
+	// Format is the format of the file. One of: json jsonc yaml toml ini
+	// env, or a format added with AddConfigFormat. Defaults to the format
+	// matching the file's extension, or else is guessed from its contents.
+	Format string
+	// EnvPrefix is the prefix of the variables in a .env config file, in
+	// place of the prefix set with SetEnvPrefix. Other formats ignore it.
+	EnvPrefix string
+}
+
+type configFile struct {
+	path    string
+	options ConfigFileOptions
+}
+
+var configFiles []*configFile
+var unknownKeys = "error"
+
+// A Source describes where a flag's value was last set.
+type Source struct {
+	// Kind is one of: default config env args code
+	Kind string
+	// Location is the config file path, environment variable name or
+	// argument, if any
+	Location string
+	// IncludedFrom is the chain of config files that included the config
+	// file, outermost first
+	IncludedFrom []string
+	// Block is the section of the config file, such as "profiles.prod",
+	// if any
+	Block string
+
+	layer int
+}
+
+var sources map[string]Source
+var currentSource = Source{Kind: "default"}
+
+// beginLayer marks the start of a new layer. Values stored from now on
+// take precedence over those stored in earlier layers.
+func beginLayer(kind string, location string) {
+	currentSource = Source{Kind: kind, Location: location, layer: currentSource.layer + 1}
+}
+
+func storeValue(name string, value any) {
+	if sources == nil {
+		sources = make(map[string]Source)
+	}
+	values[name] = value
+	sources[name] = currentSource
+}
+
+var repeat = "last-wins"
+
+// SetRepeat sets what happens when a scalar flag is set more than once in
+// the same layer, for flags that don't set their own Repeat. One of:
+// last-wins first-wins error.
+func SetRepeat(policy string) {
+	if policy != "last-wins" && policy != "first-wins" && policy != "error" {
+		log.Fatalf("Repeat policy '%s' is invalid! Must be one of: last-wins first-wins error.", policy)
+	}
+	repeat = policy
+}
+
+// setInLayer reports whether a flag has already been set in the current
+// layer. Defaults never count as being set.
+func setInLayer(name string) bool {
+	source, exists := sources[name]
+	return exists && source.layer == currentSource.layer && source.Kind != "default"
+}
+
+func storeScalar(flag *Flag, value any) error {
+	if setInLayer(flag.Name) {
+		policy := flag.Repeat
+		if policy == "" {
+			policy = repeat
+		}
+		switch policy {
+		case "first-wins":
+			return nil
+		case "error":
+			return fmt.Errorf("Value for '%s' was given more than once!", flag.Name)
+		}
+	}
+	storeValue(flag.Name, value)
+	return nil
+}
+
+var layerBases map[string]any
+var layerItems map[string]any
+
+// storeList stores items given for a list flag. Items given more than once
+// in the same layer are combined according to the flag's Repeat policy,
+// then merged with the value from lower layers according to its Merge
+// strategy.
+func storeList[T comparable](flag *Flag, items []T) error {
+	if layerBases == nil {
+		layerBases = make(map[string]any)
+	}
+	if layerItems == nil {
+		layerItems = make(map[string]any)
+	}
+
+	name := flag.Name
+	if !setInLayer(name) {
+		layerBases[name] = values[name]
+	} else if flag.Repeat != "replace" {
+		earlier, _ := layerItems[name].([]T)
+		items = slices.Concat(earlier, items)
+	}
+	layerItems[name] = items
+
+	base, _ := layerBases[name].([]T)
+	storeValue(name, mergeList(base, items, flag.Merge))
+	return nil
+}
+
+func mergeList[T comparable](base []T, items []T, strategy string) []T {
+	switch strategy {
+	case "append":
+		return slices.Concat(base, items)
+	case "prepend":
+		return slices.Concat(items, base)
+	case "union":
+		merged := []T{}
+		for _, item := range slices.Concat(base, items) {
+			if !slices.Contains(merged, item) {
+				merged = append(merged, item)
+			}
+		}
+		return merged
+	}
+	return slices.Clone(items)
+}
+
+// SourceOf returns where the value of a flag was last set.
+func SourceOf(name string) Source {
+	if _, exists := flags[name]; !exists {
+		log.Fatalf("Flag '%s' does not exist!", name)
+	}
+	return sources[name]
+}
 
 func assertValid(flag *Flag) error {
 	re, err := regexp.Compile(`^([a-z]|[0-9]|-)+$`)
@@ -62,6 +233,31 @@ func assertValid(flag *Flag) error {
 		return fmt.Errorf("Non-bool flag '%s' must have a default value.", flag.Name)
 	}
 
+	for _, envVar := range flag.EnvVars {
+		if !regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`).MatchString(envVar) {
+			return fmt.Errorf("Environment variable '%s' for flag '%s' is invalid! Must be letters, numbers and '_' only.", envVar, flag.Name)
+		}
+	}
+	if flag.NoEnv && len(flag.EnvVars) != 0 {
+		return fmt.Errorf("Flag '%s' has environment variables, but NoEnv is set.", flag.Name)
+	}
+
+	if flag.ValueType == "floats" || flag.ValueType == "ints" || flag.ValueType == "strings" {
+		if flag.Repeat != "" && flag.Repeat != "append" && flag.Repeat != "replace" {
+			return fmt.Errorf("Repeat policy '%s' for list flag '%s' is invalid! Must be one of: append replace.", flag.Repeat, flag.Name)
+		}
+		if flag.Merge != "" && flag.Merge != "replace" && flag.Merge != "append" && flag.Merge != "prepend" && flag.Merge != "union" {
+			return fmt.Errorf("Merge strategy '%s' for list flag '%s' is invalid! Must be one of: replace append prepend union.", flag.Merge, flag.Name)
+		}
+	} else {
+		if flag.Repeat != "" && flag.Repeat != "last-wins" && flag.Repeat != "first-wins" && flag.Repeat != "error" {
+			return fmt.Errorf("Repeat policy '%s' for flag '%s' is invalid! Must be one of: last-wins first-wins error.", flag.Repeat, flag.Name)
+		}
+		if flag.Merge != "" {
+			return fmt.Errorf("Flag '%s' has a merge strategy, but is not a list flag.", flag.Name)
+		}
+	}
+
 	return nil
 }
 
@@ -92,6 +288,11 @@ func Add(flag *Flag) error {
 	if flag.Shorthand != "" {
 		shorthandNames[flag.Shorthand] = flag.Name
 	}
+	// Defaults are stored below every layer, even for flags added after
+	// Load, such as those of a subcommand
+	source := currentSource
+	currentSource = Source{Kind: "default"}
+	defer func() { currentSource = source }()
 	if flag.ValueType == "bool" {
 		if err := setValue(flag, false); err != nil {
 			return err
@@ -112,43 +313,43 @@ func setValue(flag *Flag, anyValue any) error {
 		if !ok {
 			return fmt.Errorf("Value '%v' is not of type bool!", anyValue)
 		}
-		values[flag.Name] = value
+		storeValue(flag.Name, value)
 	case "float":
 		value, ok := anyValue.(float64)
 		if !ok {
 			return fmt.Errorf("Value '%v' is not of type float64!", anyValue)
 		}
-		values[flag.Name] = value
+		storeValue(flag.Name, value)
 	case "int":
 		value, ok := anyValue.(int)
 		if !ok {
 			return fmt.Errorf("Value '%v' is not of type int!", anyValue)
 		}
-		values[flag.Name] = value
+		storeValue(flag.Name, value)
 	case "string":
 		value, ok := anyValue.(string)
 		if !ok {
 			return fmt.Errorf("Value '%v' is not of type string!", anyValue)
 		}
-		values[flag.Name] = value
+		storeValue(flag.Name, value)
 	case "floats":
 		value, ok := anyValue.([]float64)
 		if !ok {
 			return fmt.Errorf("Value '%v' is not of type []float64!", anyValue)
 		}
-		values[flag.Name] = value
+		storeValue(flag.Name, value)
 	case "ints":
 		value, ok := anyValue.([]int)
 		if !ok {
 			return fmt.Errorf("Value '%v' is not of type []int!", anyValue)
 		}
-		values[flag.Name] = value
+		storeValue(flag.Name, value)
 	case "strings":
 		value, ok := anyValue.([]string)
 		if !ok {
 			return fmt.Errorf("Value '%v' is not of type []string!", anyValue)
 		}
-		values[flag.Name] = value
+		storeValue(flag.Name, value)
 	}
 
 	return nil
@@ -163,49 +364,53 @@ func SetValue(name string, value any) {
 }
 
 func setJsonValue(flag *Flag, raw json.RawMessage) error {
+	if jsonKind(raw) == "null" {
+		return jsonTypeError(jsonTypeName(flag.ValueType), raw)
+	}
+
 	switch flag.ValueType {
 	case "bool":
 		var value bool
 		if err := json.Unmarshal(raw, &value); err != nil {
-			return fmt.Errorf("JSON value '%s' is not of type bool!", string(raw))
+			return jsonTypeError("bool", raw)
 		}
-		values[flag.Name] = value
+		return storeScalar(flag, value)
 	case "float":
 		var value float64
 		if err := json.Unmarshal(raw, &value); err != nil {
-			return fmt.Errorf("JSON value '%s' is not of type float64!", string(raw))
+			return jsonTypeError("float", raw)
 		}
-		values[flag.Name] = value
+		return storeScalar(flag, value)
 	case "int":
 		var value int
 		if err := json.Unmarshal(raw, &value); err != nil {
-			return fmt.Errorf("JSON value '%s' is not of type int!", string(raw))
+			return jsonTypeError("int", raw)
 		}
-		values[flag.Name] = value
+		return storeScalar(flag, value)
 	case "string":
 		var value string
 		if err := json.Unmarshal(raw, &value); err != nil {
-			return fmt.Errorf("JSON value '%s' is not of type string!", string(raw))
+			return jsonTypeError("string", raw)
 		}
-		values[flag.Name] = value
+		return storeScalar(flag, value)
 	case "floats":
 		var value []float64
 		if err := json.Unmarshal(raw, &value); err != nil {
-			return fmt.Errorf("JSON value '%s' is not of type []float64!", string(raw))
+			return jsonTypeError("array of floats", raw)
 		}
-		values[flag.Name] = value
+		return storeList(flag, value)
 	case "ints":
 		var value []int
 		if err := json.Unmarshal(raw, &value); err != nil {
-			return fmt.Errorf("JSON value '%s' is not of type []int!", string(raw))
+			return jsonTypeError("array of ints", raw)
 		}
-		values[flag.Name] = value
+		return storeList(flag, value)
 	case "strings":
 		var value []string
 		if err := json.Unmarshal(raw, &value); err != nil {
-			return fmt.Errorf("JSON value '%s' is not of type []string!", string(raw))
+			return jsonTypeError("array of strings", raw)
 		}
-		values[flag.Name] = value
+		return storeList(flag, value)
 	}
 
 	return nil
@@ -225,61 +430,116 @@ func setStringValue(name string, str string) error {
 		if err != nil {
 			return fmt.Errorf("Value for '%s' must be a float!", flag.Name)
 		}
-		values[flag.Name] = value
-	case "floats":
-		value, err := strconv.ParseFloat(str, 64)
-		if err != nil {
-			return fmt.Errorf("Value for '%s' must be a float!", flag.Name)
-		}
-		if values[flag.Name] == nil {
-			values[flag.Name] = []float64{value}
-		} else {
-			values[flag.Name] = append(values[flag.Name].([]float64), value)
-		}
+		return storeScalar(flag, value)
 	case "int":
 		value64, err := strconv.ParseInt(str, 10, 32)
 		value := int(value64)
 		if err != nil {
 			return fmt.Errorf("Value for '%s' must be an int!", flag.Name)
 		}
-		values[flag.Name] = value
-	case "ints":
-		value64, err := strconv.ParseInt(str, 10, 32)
-		value := int(value64)
-		if err != nil {
-			return fmt.Errorf("Value for '%s' must be an int!", flag.Name)
+		return storeScalar(flag, value)
+	case "string":
+		return storeScalar(flag, str)
+	case "floats", "ints", "strings":
+		return setStringValues(name, []string{str})
+	}
+
+	return nil
+}
+
+// setStringValues parses several elements given at once for a list flag,
+// such as the parts of a delimited environment variable.
+func setStringValues(name string, strs []string) error {
+	flag, exists := flags[name]
+	if !exists {
+		log.Fatalf("Setting value for flag '%s', but flag doesn't exist!", name)
+	}
+
+	switch flag.ValueType {
+	case "floats":
+		value := make([]float64, len(strs))
+		for i, str := range strs {
+			v, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return fmt.Errorf("Value for '%s' must be a float!", flag.Name)
+			}
+			value[i] = v
 		}
-		if values[flag.Name] == nil {
-			values[flag.Name] = []int{value}
-		} else {
-			values[flag.Name] = append(values[flag.Name].([]int), value)
+		return storeList(flag, value)
+	case "ints":
+		value := make([]int, len(strs))
+		for i, str := range strs {
+			v, err := strconv.ParseInt(str, 10, 32)
+			if err != nil {
+				return fmt.Errorf("Value for '%s' must be an int!", flag.Name)
+			}
+			value[i] = int(v)
 		}
-	case "string":
-		values[flag.Name] = str
+		return storeList(flag, value)
 	case "strings":
-		if values[flag.Name] == nil {
-			values[flag.Name] = []string{str}
-		} else {
-			values[flag.Name] = append(values[flag.Name].([]string), str)
-		}
+		return storeList(flag, slices.Clone(strs))
+	default:
+		log.Fatalf("Flag '%s' is not a list!", name)
 	}
 
 	return nil
 }
 
+var rejectFlagLikeValues = false
+
+// SetRejectFlagLikeValues controls what happens when a flag that takes a
+// value is followed by something that looks like a flag, as in
+// "--name --verbose". By default the next argument is always taken as the
+// value, so name is set to "--verbose". When reject is true, this is an
+// error instead, except for negative numbers given to number flags.
+func SetRejectFlagLikeValues(reject bool) {
+	rejectFlagLikeValues = reject
+}
+
+func looksLikeFlag(flag *Flag, arg string) bool {
+	if !strings.HasPrefix(arg, "-") || arg == "-" {
+		return false
+	}
+	if flag.ValueType == "float" ||
+		flag.ValueType == "int" ||
+		flag.ValueType == "floats" ||
+		flag.ValueType == "ints" {
+		if _, err := strconv.ParseFloat(arg, 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
 func parseArgs(args ...string) error {
+	beginLayer("args", "")
 	if len(args) <= 1 {
 		return nil
 	}
 
+	var errs ConfigErrors
+	fail := func(i int, flag string, message string) {
+		err := newError(flag, message)
+		err.Location = fmt.Sprintf("argument %d", i)
+		errs = append(errs, err)
+	}
+
 	needValueForName := ""
+	needValueForArg := ""
 	asPositionals := false
-	for _, arg := range args[1:] {
+	for i, arg := range args[1:] {
+		i++
+		currentSource.Location = fmt.Sprintf("argument %d", i)
+		if needValueForName != "" && rejectFlagLikeValues && looksLikeFlag(flags[needValueForName], arg) {
+			fail(i-1, needValueForName, fmt.Sprintf("Flag %s requires a value, but got %s!", needValueForArg, arg))
+			needValueForName = ""
+		}
+
 		if asPositionals {
 			positionals = append(positionals, arg)
 		} else if needValueForName != "" {
 			if err := setStringValue(needValueForName, arg); err != nil {
-				return err
+				fail(i, needValueForName, err.Error())
 			}
 			needValueForName = ""
 		} else if arg == "-" {
@@ -295,13 +555,17 @@ func parseArgs(args ...string) error {
 
 			flag, exists := flags[name]
 			if !exists {
-				return fmt.Errorf("Unknown flag: --%s", name)
+				fail(i, "", fmt.Sprintf("Unknown flag: --%s", name))
+				continue
 			}
 
 			if flag.ValueType == "bool" {
-				values[name] = true
+				if err := storeScalar(flag, true); err != nil {
+					fail(i, name, err.Error())
+				}
 			} else {
 				needValueForName = name
+				needValueForArg = arg
 			}
 		} else if strings.HasPrefix(arg, "-") {
 			shorthands := arg[1:]
@@ -310,7 +574,8 @@ func parseArgs(args ...string) error {
 
 				name, exists := shorthandNames[shorthand]
 				if !exists {
-					return fmt.Errorf("Unknown flag: -%s", shorthand)
+					fail(i, "", fmt.Sprintf("Unknown flag: -%s", shorthand))
+					break
 				}
 
 				flag, exists := flags[name]
@@ -319,11 +584,15 @@ func parseArgs(args ...string) error {
 				}
 
 				if flag.ValueType == "bool" {
-					values[name] = true
+					if err := storeScalar(flag, true); err != nil {
+						fail(i, name, err.Error())
+					}
 				} else if c != len(shorthands)-1 {
-					return fmt.Errorf("Invalid flag: -%s is unable to set -%s", shorthands, shorthand)
+					fail(i, name, fmt.Sprintf("Invalid flag: -%s is unable to set -%s", shorthands, shorthand))
+					break
 				} else {
 					needValueForName = name
+					needValueForArg = "-" + shorthand
 				}
 			}
 		} else {
@@ -331,26 +600,11 @@ func parseArgs(args ...string) error {
 		}
 	}
 
-	return nil
-}
-
-func parseJson(data []byte) error {
-	var config map[string]json.RawMessage
-	if err := json.Unmarshal(data, &config); err != nil {
-		log.Fatalf("Failed to parse JSON: %s", err)
+	if needValueForName != "" {
+		fail(len(args)-1, needValueForName, fmt.Sprintf("Flag %s requires a value!", needValueForArg))
 	}
 
-	for name, raw := range config {
-		flag, exists := flags[name]
-		if !exists {
-			return fmt.Errorf("Invalid JSON: Option '%s' does not exist.", name)
-		}
-		if err := setJsonValue(flag, raw); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return errs.err()
 }
 
 func getValue[T bool | float64 | int | string | []float64 | []int | []string](name string, valueType string) T {
@@ -395,12 +649,37 @@ func StringValues(name string) []string {
 	return getValue[[]string](name, "strings")
 }
 
+func assertValidUnknownKeys(policy string) {
+	if policy != "error" && policy != "warn" && policy != "ignore" {
+		log.Fatalf("Unknown key policy '%s' is invalid! Must be one of: error warn ignore.", policy)
+	}
+}
+
+// SetUnknownKeys sets what to do with config file keys that are not flags,
+// for files that don't set their own policy. One of: error warn ignore.
+func SetUnknownKeys(policy string) {
+	assertValidUnknownKeys(policy)
+	unknownKeys = policy
+}
+
 func AddConfigFile(path string) {
-	if configFiles == nil {
-		configFiles = []string{path}
-	} else {
-		configFiles = append(configFiles, path)
+	AddConfigFileWithOptions(path, ConfigFileOptions{})
+}
+
+// AddConfigFileWithFormat adds a config file in the given format, whatever
+// its extension.
+func AddConfigFileWithFormat(path string, format string) {
+	AddConfigFileWithOptions(path, ConfigFileOptions{Format: format})
+}
+
+func AddConfigFileWithOptions(path string, options ConfigFileOptions) {
+	if options.UnknownKeys != "" {
+		assertValidUnknownKeys(options.UnknownKeys)
 	}
+	if options.Format != "" {
+		assertValidFormat(options.Format)
+	}
+	configFiles = append(configFiles, &configFile{path: path, options: options})
 }
 
 func AddHomeConfigFile(path string) {
@@ -425,60 +704,119 @@ func toEnvVar(name string) string {
 	return strings.ReplaceAll(strings.ToUpper(name), "-", "_")
 }
 
-func load(args ...string) {
-	// 1. Config files
-	for _, file := range configFiles {
-		if fileExists(file) {
-			file, err := os.Open(file)
-			if err != nil {
-				log.Printf("Failed to open file: %s\n", err)
+// loadEnv reads the environment variables of every flag, including those
+// from .env files. Unless quiet, deprecated variables print a warning.
+func loadEnv(dotEnv map[string]dotEnvValue, quiet bool) error {
+	var errs ConfigErrors
+	beginLayer("env", "")
+	// Flags are read in order of name, so that errors are reported in the
+	// same order every time
+	for _, name := range slices.Sorted(maps.Keys(flags)) {
+		flag := flags[name]
+		if isListFlag(flag) {
+			if err := loadListEnv(flag, dotEnv, quiet); err != nil {
+				errs = append(errs, newError(flag.Name, err.Error()))
 			}
-			defer file.Close()
+			continue
+		}
+		value, location, exists := lookupFlagEnv(flag, dotEnv, quiet)
+		if !exists {
+			continue
+		}
+		currentSource.Location = location
+		var err error
+		if flag.ValueType == "bool" && fromDotEnv(location, dotEnv) {
+			// The same as when the .env file is read as a config file
+			err = setTextValue(flag, value, true)
+		} else if flag.ValueType == "bool" {
+			storeValue(flag.Name, true)
+		} else {
+			err = setStringValue(flag.Name, value)
+		}
+		if err != nil {
+			errs = append(errs, newError(flag.Name, err.Error()))
+		}
+	}
+	return errs.err()
+}
 
-			data, _ := io.ReadAll(file)
-			if err != nil {
-				log.Printf("Failed to read file: %s\n", err)
-			}
+type readAheadValue struct {
+	value  any
+	source Source
+}
 
-			if err := parseJson(data); err != nil {
-				log.Fatal(err)
-			}
+// readAhead holds the values that the environment and args will set, so
+// that they can select a profile or match block while config files are
+// still loading.
+var readAhead map[string]readAheadValue
+
+// readAheadValues loads the environment and args and then throws away the
+// result, so that values are read exactly as they will be once the config
+// files are loaded. Errors and warnings are left for that load to report.
+func readAheadValues(args []string, dotEnv map[string]dotEnvValue) map[string]readAheadValue {
+	savedValues := maps.Clone(values)
+	savedSources := maps.Clone(sources)
+	savedSource := currentSource
+	savedPositionals := positionals
+	savedBases := maps.Clone(layerBases)
+	savedItems := maps.Clone(layerItems)
+	defer func() {
+		values = savedValues
+		sources = savedSources
+		currentSource = savedSource
+		positionals = savedPositionals
+		layerBases = savedBases
+		layerItems = savedItems
+	}()
+
+	loadEnv(dotEnv, true)
+	parseArgs(args...)
+	ahead := make(map[string]readAheadValue)
+	for name, source := range sources {
+		if source.layer > savedSource.layer {
+			ahead[name] = readAheadValue{value: values[name], source: source}
 		}
 	}
+	return ahead
+}
 
-	// 2. Environment variables
-	for _, flag := range flags {
-		envVar := toEnvVar(flag.Name)
-		value, exists := os.LookupEnv(envVar)
-		if exists {
-			if flag.ValueType == "floats" ||
-				flag.ValueType == "ints" ||
-				flag.ValueType == "strings" {
-				if flag.EnvVarDelimiter != "" {
-					for _, s := range strings.Split(value, flag.EnvVarDelimiter) {
-						if err := setStringValue(flag.Name, s); err != nil {
-							log.Fatal(err)
-						}
-					}
-				}
-				continue
-			}
-			if flag.ValueType == "bool" {
-				values[flag.Name] = true
-			} else if err := setStringValue(flag.Name, value); err != nil {
-				log.Fatal(err)
-			}
+// load reads every layer in order of precedence. Errors do not stop
+// loading, so that every problem can be reported at once.
+func load(args ...string) error {
+	var errs ConfigErrors
+
+	dotEnv, dotEnvErr := loadDotEnvFiles()
+	readAhead = readAheadValues(args, dotEnv)
+
+	// 1. Config files, followed by the selected profile
+	profiles = nil
+	for _, file := range configFiles {
+		if fileExists(file.path) {
+			errs.collect(loadConfigFile(file, nil, args, dotEnv))
 		}
 	}
+	errs.collect(dotEnvErr)
+	errs.collect(applyProfile())
+
+	// 2. Environment variables, including those from .env files
+	errs.collect(loadEnv(dotEnv, false))
 
 	// 3. Args
-	if err := parseArgs(args...); err != nil {
-		log.Fatal(err)
-	}
+	errs.collect(parseArgs(args...))
+
+	// Values set by the program after loading override every layer
+	beginLayer("code", "")
+
+	// 4. Validation
+	errs.collect(validate())
+
+	return errs.err()
 }
 
-func Load() {
-	load(os.Args...)
+// Load reads flags from config files, environment variables and program
+// args. It returns a ConfigErrors holding every problem that was found.
+func Load() error {
+	return load(os.Args...)
 }
 
 func Positionals() []string {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -13,6 +14,39 @@ func tests_reset() {
 	values = nil
 	positionals = nil
 	configFiles = nil
+	dotEnvFiles = nil
+	profilesEnabled = false
+	appName = ""
+	envPrefix = ""
+	legacyEnvPrefixes = nil
+	profiles = nil
+	configParsers = make(map[string]ConfigParser)
+	configExtensions = make(map[string]string)
+	unknownKeys = "error"
+	rejectFlagLikeValues = false
+	repeat = "last-wins"
+	layerBases = nil
+	layerItems = nil
+	rules = nil
+	groups = nil
+	sources = nil
+	currentSource = Source{Kind: "default"}
+}
+
+// isolateEnv unsets the environment variables of the flags added so far
+// until the end of the test, so that the developer's environment, such as
+// a PORT set by a container, can't change its result.
+func isolateEnv(t *testing.T) {
+	for _, flag := range flags {
+		for _, name := range append(envVarsOf(flag), legacyEnvVarsOf(flag)...) {
+			for _, name := range []string{name, name + "_0"} {
+				if _, exists := os.LookupEnv(name); exists {
+					t.Setenv(name, "")
+					os.Unsetenv(name)
+				}
+			}
+		}
+	}
 }
 
 func TestAssertValid(t *testing.T) {
@@ -415,6 +449,37 @@ func TestParseArgs(t *testing.T) {
 	if err := parseArgs("cmd", "-u"); err == nil {
 		t.Error("'cmd -u' succeeded; expected failure")
 	}
+
+	// Missing values
+	if err := parseArgs("cmd", "--mystring"); err == nil || !strings.Contains(err.Error(), "Flag --mystring requires a value!") {
+		t.Errorf("'cmd --mystring' returned %v; expected missing value error", err)
+	}
+	if err := parseArgs("cmd", "-s"); err == nil || !strings.Contains(err.Error(), "Flag -s requires a value!") {
+		t.Errorf("'cmd -s' returned %v; expected missing value error", err)
+	}
+
+	// Flag-like values
+	if err := parseArgs("cmd", "--mystring", "--mybool-a"); err != nil {
+		t.Errorf("'cmd --mystring --mybool-a' failed: %v", err)
+	}
+	if StringValue("mystring") != "--mybool-a" {
+		t.Error("mystring is not '--mybool-a'")
+	}
+	SetRejectFlagLikeValues(true)
+	values["mybool-a"] = false
+	if err := parseArgs("cmd", "--mystring", "--mybool-a"); err == nil {
+		t.Error("'cmd --mystring --mybool-a' succeeded with flag-like values rejected; expected failure")
+	}
+	if BoolValue("mybool-a") != true {
+		t.Error("rejected value --mybool-a was not parsed as a flag")
+	}
+	if err := parseArgs("cmd", "--myint", "-5", "-f", "-1.5"); err != nil {
+		t.Errorf("'cmd --myint -5 -f -1.5' failed with flag-like values rejected: %v", err)
+	}
+	if IntValue("myint") != -5 || FloatValue("myfloat") != -1.5 {
+		t.Error("negative numbers were not accepted with flag-like values rejected")
+	}
+	SetRejectFlagLikeValues(false)
 }
 
 func TestLoad(t *testing.T) {
@@ -529,3 +594,96 @@ func TestLoad(t *testing.T) {
 	os.Remove(configPath)
 	os.Remove(config2Path)
 }
+
+func TestRepeat(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 0}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "first", ValueType: "int", DefaultValue: 0, Repeat: "first-wins"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "once", ValueType: "int", DefaultValue: 0, Repeat: "error"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "last-tags", ValueType: "strings", DefaultValue: []string{}, Repeat: "replace"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "bad", ValueType: "strings", DefaultValue: []string{}, Repeat: "first-wins"}); err == nil {
+		t.Error("list flag with Repeat 'first-wins' is valid; want invalid")
+	}
+
+	if err := parseArgs("cmd", "--port", "80", "--port", "8080", "--first", "1", "--first", "2", "--once", "1",
+		"--tags", "a", "--tags", "b", "--last-tags", "a", "--last-tags", "b"); err != nil {
+		t.Errorf("parseArgs failed: %v", err)
+	}
+	if IntValue("port") != 8080 {
+		t.Error("port is not 8080 with last-wins policy")
+	}
+	if IntValue("first") != 1 {
+		t.Error("first is not 1 with first-wins policy")
+	}
+	if tags := StringValues("tags"); len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Errorf("tags is %v; expected [a b] with append policy", tags)
+	}
+	if tags := StringValues("last-tags"); len(tags) != 1 || tags[0] != "b" {
+		t.Errorf("last-tags is %v; expected [b] with replace policy", tags)
+	}
+
+	if err := parseArgs("cmd", "--once", "1", "--once", "2"); err == nil {
+		t.Error("'cmd --once 1 --once 2' succeeded with error policy; expected failure")
+	}
+
+	// Global policy
+	SetRepeat("error")
+	if err := parseArgs("cmd", "--port", "80", "--port", "8080"); err == nil {
+		t.Error("'cmd --port 80 --port 8080' succeeded with global error policy; expected failure")
+	}
+	if err := parseArgs("cmd", "--port", "80"); err != nil {
+		t.Errorf("'cmd --port 80' failed with global error policy: %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests_reset()
+
+	for _, merge := range []string{"", "replace", "append", "prepend", "union"} {
+		if err := Add(&Flag{Name: "tags-" + merge, ValueType: "strings", DefaultValue: []string{"a"}, Merge: merge}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := Add(&Flag{Name: "bad", ValueType: "string", DefaultValue: "", Merge: "append"}); err == nil {
+		t.Error("string flag with Merge 'append' is valid; want invalid")
+	}
+
+	beginLayer("config", "config.json")
+	for _, merge := range []string{"", "replace", "append", "prepend", "union"} {
+		if err := setJsonValue(flags["tags-"+merge], []byte(`["b", "c"]`)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	args := []string{"cmd"}
+	for _, merge := range []string{"", "replace", "append", "prepend", "union"} {
+		args = append(args, "--tags-"+merge, "a", "--tags-"+merge, "d")
+	}
+	if err := parseArgs(args...); err != nil {
+		log.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"tags-":        "[a d]",
+		"tags-replace": "[a d]",
+		"tags-append":  "[a b c a d]",
+		"tags-prepend": "[a d b c a]",
+		"tags-union":   "[a b c d]",
+	}
+	for name, want := range expected {
+		if got := fmt.Sprint(StringValues(name)); got != want {
+			t.Errorf("%s is %s; expected %s", name, got, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"slices"
+	"strings"
 )
 
 func appendDefaultValue(description *string, value any) {
@@ -33,6 +34,9 @@ func FprintUsageWithWidth(w io.Writer, width int) {
 		if flag.Shorthand != "" {
 			fmt.Fprintf(w, " / -%s", flag.Shorthand)
 		}
+		if readsEnv(flag) {
+			fmt.Fprintf(w, " (%s)", envVarsUsage(flag))
+		}
 		fmt.Fprintln(w)
 
 		desc := flag.Description
@@ -83,6 +87,20 @@ func FprintUsageWithWidth(w io.Writer, width int) {
 			fmt.Fprintln(w)
 		}
 	}
+
+	if len(groups) != 0 {
+		fmt.Fprintln(w)
+		for _, group := range groups {
+			fmt.Fprintln(w, group)
+		}
+	}
+
+	if profilesEnabled {
+		if names := Profiles(); len(names) != 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "Profiles: %s\n", strings.Join(names, ", "))
+		}
+	}
 }
 
 func PrintUsageWithWidth(width int) {
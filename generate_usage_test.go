@@ -14,16 +14,16 @@ func makeWhiteSpaceVisible(str string) string {
 func TestFprintUsageWithWidth(t *testing.T) {
 	tests_reset()
 
-	target := `--long / -l
+	target := `--long / -l ($LONG)
     A flag with a super duper long description. Like, this is a very long 
     description and is totally overwhelming the user. We really need to stop 
     making things so long and complicated guys. The poor users can't handle it! 
     (default: long)
 
---name / -n
+--name / -n ($NAME)
     The person we want to greet (default: john)
 
---zzz
+--zzz ($ZZZ)
     An argument with no shorthand! (default: false)
 `
 
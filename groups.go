@@ -0,0 +1,144 @@
+package gears
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+type flagGroup struct {
+	// kind is one of: exclusive together one
+	kind  string
+	names []string
+}
+
+var groups []*flagGroup
+
+// MutuallyExclusive allows at most one of the named flags to be set. When
+// they are set in different layers, the highest layer wins and the others
+// are reset to their defaults.
+func MutuallyExclusive(names ...string) {
+	addGroup("exclusive", names)
+}
+
+// RequiredTogether requires that either all or none of the named flags are
+// set.
+func RequiredTogether(names ...string) {
+	addGroup("together", names)
+}
+
+// OneRequired requires that at least one of the named flags is set.
+func OneRequired(names ...string) {
+	addGroup("one", names)
+}
+
+// addGroup checks the named flags when the group is registered, so that a
+// typo fails at startup rather than only once a config is loaded.
+func addGroup(kind string, names []string) {
+	if len(names) == 0 {
+		log.Fatal("Flag group must name at least one flag!")
+	}
+	for i, name := range names {
+		if _, exists := flags[name]; !exists {
+			log.Fatalf("Flag '%s' does not exist!", name)
+		}
+		if slices.Contains(names[:i], name) {
+			log.Fatalf("Flag '%s' is listed more than once in a group!", name)
+		}
+	}
+	groups = append(groups, &flagGroup{kind: kind, names: slices.Clone(names)})
+}
+
+func dashedList(names []string) string {
+	dashed := make([]string, len(names))
+	for i, name := range names {
+		dashed[i] = "--" + name
+	}
+	return strings.Join(dashed, ", ")
+}
+
+func (group *flagGroup) String() string {
+	list := dashedList(group.names)
+	switch group.kind {
+	case "exclusive":
+		return fmt.Sprintf("Only one of %s may be used", list)
+	case "together":
+		return fmt.Sprintf("%s must be used together", list)
+	case "one":
+		return fmt.Sprintf("One of %s is required", list)
+	}
+	return list
+}
+
+// isSet reports whether a flag was set by a layer above its default. Bool
+// flags only count as set when they are true.
+func isSet(name string) bool {
+	flag := flags[name]
+	if sources[name].Kind == "" || sources[name].Kind == "default" {
+		return false
+	}
+	if flag.ValueType == "bool" {
+		return values[name] == true
+	}
+	return true
+}
+
+func resetToDefault(name string) {
+	flag := flags[name]
+	var value any
+	switch flag.ValueType {
+	case "bool":
+		value = false
+	case "floats":
+		value = slices.Clone(flag.DefaultValue.([]float64))
+	case "ints":
+		value = slices.Clone(flag.DefaultValue.([]int))
+	case "strings":
+		value = slices.Clone(flag.DefaultValue.([]string))
+	default:
+		value = flag.DefaultValue
+	}
+	values[name] = value
+	sources[name] = Source{Kind: "default"}
+}
+
+func checkGroups() []error {
+	var errs []error
+	for _, group := range groups {
+		var set []string
+		for _, name := range group.names {
+			if isSet(name) {
+				set = append(set, name)
+			}
+		}
+
+		switch group.kind {
+		case "exclusive":
+			top := 0
+			for _, name := range set {
+				top = max(top, sources[name].layer)
+			}
+			var inTop []string
+			for _, name := range set {
+				if sources[name].layer < top {
+					resetToDefault(name)
+				} else {
+					inTop = append(inTop, name)
+				}
+			}
+			if len(inTop) > 1 {
+				errs = append(errs, fmt.Errorf("Flags %s cannot be used together!", dashedList(inTop)))
+			}
+		case "together":
+			if len(set) != 0 && len(set) != len(group.names) {
+				errs = append(errs, fmt.Errorf("Flags %s must be used together, but only %s was set!", dashedList(group.names), dashedList(set)))
+			}
+		case "one":
+			if len(set) == 0 {
+				errs = append(errs, fmt.Errorf("%s!", group))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,134 @@
+package gears
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	tests_reset()
+
+	for _, name := range []string{"json", "yaml", "table"} {
+		if err := Add(&Flag{Name: name, ValueType: "bool"}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := Add(&Flag{Name: "username", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "password", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	MutuallyExclusive("json", "yaml", "table")
+	RequiredTogether("username", "password")
+	OneRequired("json", "yaml", "table")
+
+	// Nothing set
+	if err := validate(); err == nil || !strings.Contains(err.Error(), "One of --json, --yaml, --table is required") {
+		t.Errorf("OneRequired not enforced: %v", err)
+	}
+
+	// Lower layer is overridden instead of conflicting
+	beginLayer("config", "config.json")
+	storeValue("json", true)
+	beginLayer("args", "")
+	storeValue("yaml", true)
+	if err := validate(); err != nil {
+		t.Errorf("values from different layers conflicted: %v", err)
+	}
+	if BoolValue("json") != false || SourceOf("json").Kind != "default" {
+		t.Error("json from lower layer was not reset to its default")
+	}
+	if BoolValue("yaml") != true {
+		t.Error("yaml from args was not kept")
+	}
+
+	// Same layer conflicts
+	storeValue("table", true)
+	if err := validate(); err == nil || !strings.Contains(err.Error(), "--yaml, --table cannot be used together") {
+		t.Errorf("MutuallyExclusive not enforced: %v", err)
+	}
+	resetToDefault("table")
+
+	// Required together
+	storeValue("username", "me")
+	if err := validate(); err == nil || !strings.Contains(err.Error(), "must be used together") {
+		t.Errorf("RequiredTogether not enforced: %v", err)
+	}
+	storeValue("password", "secret")
+	if err := validate(); err != nil {
+		t.Errorf("validate failed with valid groups: %v", err)
+	}
+}
+
+func TestGroupsResetList(t *testing.T) {
+	tests_reset()
+
+	defaults := []string{"a"}
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: defaults}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "all", ValueType: "bool"}); err != nil {
+		log.Fatal(err)
+	}
+	MutuallyExclusive("tags", "all")
+
+	beginLayer("config", "config.json")
+	if err := setStringValue("tags", "b"); err != nil {
+		t.Fatal(err)
+	}
+	beginLayer("args", "")
+	storeValue("all", true)
+	if err := validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	StringValues("tags")[0] = "changed"
+	if defaults[0] != "a" {
+		t.Errorf("changing a reset list changed its default: %v", defaults)
+	}
+}
+
+func TestGroupsUsage(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "json", ValueType: "bool", Description: "Print JSON"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "yaml", ValueType: "bool", Description: "Print YAML"}); err != nil {
+		log.Fatal(err)
+	}
+	MutuallyExclusive("json", "yaml")
+
+	var w bytes.Buffer
+	FprintUsage(&w)
+	if !strings.HasSuffix(w.String(), "\nOnly one of --json, --yaml may be used\n") {
+		t.Errorf("usage does not list groups:\n%s", w.String())
+	}
+}
+
+func TestGroupsFlagAddedAfterLoad(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	isolateEnv(t)
+	if err := load("cmd"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Added after Load, like the flag of a subcommand
+	if err := Add(&Flag{Name: "c", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if source := SourceOf("c"); source.Kind != "default" {
+		t.Errorf("default of flag added after load has source %v; want default", source)
+	}
+	RequiredTogether("c", "port")
+	if err := validate(); err != nil {
+		t.Errorf("default of flag added after load counted as set: %v", err)
+	}
+}
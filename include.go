@@ -0,0 +1,85 @@
+package gears
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// splitIncludes separates the "$include" keys of a config file from the
+// rest of its keys.
+func splitIncludes(entries []configEntry) ([]configEntry, []configEntry) {
+	var rest []configEntry
+	var includes []configEntry
+	for _, entry := range entries {
+		if entry.key == "$include" {
+			includes = append(includes, entry)
+		} else {
+			rest = append(rest, entry)
+		}
+	}
+	return rest, includes
+}
+
+// includePaths returns the files listed by an "$include" key, which is a
+// path or an array of paths. Paths are relative to the including file, and
+// may be glob patterns. Files matching a pattern are included in lexical
+// order.
+func includePaths(path string, include configEntry) ([]string, error) {
+	fail := func(message string) error {
+		return configError(include.line, include.column, "", "\"$include\": "+message)
+	}
+
+	var patterns []string
+	if include.text != nil {
+		patterns = []string{*include.text}
+	} else if err := json.Unmarshal(include.raw, &patterns); err != nil {
+		var pattern string
+		if err := json.Unmarshal(include.raw, &pattern); err != nil {
+			return nil, fail(fmt.Sprintf("expected string or array of strings, got %s", jsonKind(include.raw)))
+		}
+		patterns = []string{pattern}
+	}
+
+	var paths []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fail(fmt.Sprintf("pattern '%s' is invalid", pattern))
+		}
+		if len(matches) == 0 && !hasGlobMeta(pattern) {
+			return nil, fail(fmt.Sprintf("file '%s' does not exist", pattern))
+		}
+		for _, match := range matches {
+			// Backup files are only included by name
+			if fileExists(match) && !(hasGlobMeta(pattern) && isBackupFile(filepath.Base(match))) {
+				paths = append(paths, match)
+			}
+		}
+	}
+	return paths, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return slices.ContainsFunc([]rune(pattern), func(c rune) bool {
+		return c == '*' || c == '?' || c == '[' || c == '\\'
+	})
+}
+
+// isIncluded reports whether path is one of the files in an include chain.
+func isIncluded(path string, chain []string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, included := range chain {
+		if includedAbs, err := filepath.Abs(included); err == nil && includedAbs == abs {
+			return true
+		}
+	}
+	return false
+}
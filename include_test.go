@@ -0,0 +1,88 @@
+package gears
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFiles(dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			log.Fatal("Failed to write config: ", err)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "hello-name", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	isolateEnv(t)
+
+	dir := t.TempDir()
+	writeConfigFiles(dir, map[string]string{
+		"base.json":          `{"port": 80, "hello-name": "base", "tags": ["base"]}`,
+		"hosts/web.json":     `{"$include": ["../base.json", "../fragments/*.yaml"], "port": 8080}`,
+		"fragments/a.yaml":   "hello-name: fragment\n",
+		"fragments/b.yaml":   "tags: [fragment]\n",
+		"fragments/c.yaml~":  "port: 1\n",
+		"hosts/bad.json":     `{"$include": "../broken.json"}`,
+		"broken.json":        `{"port": "80"}`,
+		"hosts/loop.json":    `{"$include": "loop2.ini"}`,
+		"hosts/loop2.ini":    "$include = loop.json\n",
+		"hosts/missing.json": "{\n  \"$include\": \"nowhere.json\"\n}",
+	})
+	web := filepath.Join(dir, "hosts", "web.json")
+	AddConfigFile(web)
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if IntValue("port") != 8080 {
+		t.Error("including file did not take precedence over included files")
+	}
+	if StringValue("hello-name") != "fragment" {
+		t.Error("later included file did not take precedence over earlier one")
+	}
+	if tags := StringValues("tags"); len(tags) != 1 || tags[0] != "fragment" {
+		t.Errorf("tags is %v; expected [fragment]", tags)
+	}
+	source := SourceOf("hello-name")
+	if source.Location != filepath.Join(dir, "fragments", "a.yaml") || len(source.IncludedFrom) != 1 || source.IncludedFrom[0] != web {
+		t.Errorf("hello-name has source %v; expected fragments/a.yaml included from hosts/web.json", source)
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"bad.json", filepath.Join(dir, "broken.json") + `:1:2: "port": expected int, got string (included from ` + filepath.Join(dir, "hosts", "bad.json") + ")"},
+		{"loop.json", filepath.Join(dir, "hosts", "loop2.ini") + ":1:1: \"$include\": '" + filepath.Join(dir, "hosts", "loop.json") + "' includes itself (included from " + filepath.Join(dir, "hosts", "loop.json") + ")"},
+		{"missing.json", filepath.Join(dir, "hosts", "missing.json") + ":2:3: \"$include\": file '" + filepath.Join(dir, "hosts", "nowhere.json") + "' does not exist"},
+	}
+	for _, test := range tests {
+		tests_reset()
+		if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+			log.Fatal(err)
+		}
+		isolateEnv(t)
+		AddConfigFile(filepath.Join(dir, "hosts", test.file))
+		err := load()
+		if err == nil || err.Error() != test.want {
+			t.Errorf("load(%s) = %v; want %s", test.file, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package gears
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseIni reads the keys of an INI or git-config style file. Section names
+// become flag name prefixes, so "port" in "[server]" sets server-port, and
+// "[remote "origin"]" prefixes keys with remote-origin. A key may be given
+// more than once to set several values of a list flag.
+func parseIni(data []byte) ([]configEntry, error) {
+	var entries []configEntry
+	section := ""
+	// header is the entry of the last section header, which is kept if the
+	// section has no keys
+	var header *configEntry
+	count := 0
+	endSection := func() {
+		if header != nil && len(entries) == count {
+			entries = append(entries, *header)
+		}
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNumber := i + 1
+		trimmed := strings.TrimSpace(line)
+		column := strings.Index(line, trimmed) + 1
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
+			continue
+		}
+
+		if trimmed[0] == '[' {
+			end := strings.LastIndex(trimmed, "]")
+			if end == -1 || strings.TrimSpace(stripIniComment(trimmed[end+1:])) != "" {
+				return nil, configError(lineNumber, column, "", "Invalid INI: expected ']' at the end of the section header")
+			}
+			name, subsection, hasSubsection := strings.Cut(strings.TrimSpace(trimmed[1:end]), " ")
+			parts := strings.Split(strings.ToLower(name), ".")
+			if hasSubsection {
+				sub, err := unquoteIni(strings.TrimSpace(subsection))
+				if err != nil {
+					return nil, configError(lineNumber, column, "", "Invalid INI: "+err.Error())
+				}
+				parts = append(parts, strings.ToLower(sub))
+			}
+			section = strings.Join(parts, ".")
+			endSection()
+			header = &configEntry{key: section, section: true, line: lineNumber, column: column}
+			count = len(entries)
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(trimmed, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			return nil, configError(lineNumber, column, "", "Invalid INI: expected 'key = value'")
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+
+		text := ""
+		if hasValue {
+			var err error
+			text, err = unquoteIni(strings.TrimSpace(stripIniComment(value)))
+			if err != nil {
+				return nil, configError(lineNumber, column, configFlagName(key), fmt.Sprintf("\"%s\": %s", key, err))
+			}
+		}
+		entries = append(entries, configEntry{key: key, text: &text, line: lineNumber, column: column})
+	}
+	endSection()
+	return entries, nil
+}
+
+// stripIniComment removes a trailing comment that is not inside quotes.
+func stripIniComment(value string) string {
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case (c == '#' || c == ';') && !quoted:
+			return value[:i]
+		}
+	}
+	return value
+}
+
+// unquoteIni removes the double quotes around a value, if any, along with
+// its escapes.
+func unquoteIni(value string) (string, error) {
+	if !strings.HasPrefix(value, "\"") {
+		return value, nil
+	}
+	if len(value) < 2 || !strings.HasSuffix(value, "\"") || strings.HasSuffix(value, "\\\"") && !strings.HasSuffix(value, "\\\\\"") {
+		return "", fmt.Errorf("unterminated string")
+	}
+
+	var b strings.Builder
+	inner := value[1 : len(value)-1]
+	for i := 0; i < len(inner); i++ {
+		if inner[i] != '\\' || i+1 == len(inner) {
+			b.WriteByte(inner[i])
+			continue
+		}
+		i++
+		switch inner[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\':
+			b.WriteByte(inner[i])
+		default:
+			return "", fmt.Errorf("invalid escape '\\%c'", inner[i])
+		}
+	}
+	return b.String(), nil
+}
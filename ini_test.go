@@ -0,0 +1,81 @@
+package gears
+
+import (
+	"log"
+	"testing"
+)
+
+func TestParseIni(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "name", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "verbose", ValueType: "bool"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "server-port", ValueType: "int", DefaultValue: 0}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "server-tags", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "server-ratios", ValueType: "floats", DefaultValue: []float64{}, EnvVarDelimiter: ","}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "remote-origin-url", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	config := `# comment
+; another comment
+name = " spaced # not a comment " ; comment
+verbose
+
+[server]
+port = 8080
+tags = a
+tags = b # second
+ratios = 1.5,2
+
+[remote "origin"]
+	url = https://example.com/repo.git
+`
+	if err := loadConfigData(t, "config.ini", INI, []byte(config), "error"); err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if StringValue("name") != " spaced # not a comment " {
+		t.Errorf("name is '%s'", StringValue("name"))
+	}
+	if !BoolValue("verbose") {
+		t.Error("verbose is false; expected true")
+	}
+	if IntValue("server-port") != 8080 {
+		t.Error("server-port is not 8080")
+	}
+	if tags := StringValues("server-tags"); len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Errorf("server-tags is %v; expected [a b]", tags)
+	}
+	if ratios := FloatValues("server-ratios"); len(ratios) != 2 || ratios[0] != 1.5 || ratios[1] != 2 {
+		t.Errorf("server-ratios is %v; expected [1.5 2]", ratios)
+	}
+	if StringValue("remote-origin-url") != "https://example.com/repo.git" {
+		t.Errorf("remote-origin-url is '%s'", StringValue("remote-origin-url"))
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"[server]\n  port = abc\n", `config.ini:2:3: "server.port": Value for 'server-port' must be an int!`},
+		{"verbose = maybe\n", `config.ini:1:1: "verbose": Value for 'verbose' must be a bool!`},
+		{"[server]\nprot = 80\n", `config.ini:2:1: "server.prot": option does not exist`},
+		{"[server\n", `config.ini:1:1: Invalid INI: expected ']' at the end of the section header`},
+		{"name = \"abc\n", `config.ini:1:1: "name": unterminated string`},
+	}
+	for _, test := range tests {
+		err := loadConfigData(t, "config.ini", INI, []byte(test.config), "error")
+		if err == nil || err.Error() != test.want {
+			t.Errorf("loadConfigData(ini, %q) = %v; want %s", test.config, err, test.want)
+		}
+	}
+}
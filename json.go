@@ -0,0 +1,237 @@
+package gears
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// jsonKind describes the type of a raw JSON value for error messages.
+func jsonKind(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "nothing"
+	}
+	switch raw[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	}
+	if bytes.ContainsAny(raw, ".eE") {
+		return "float"
+	}
+	return "int"
+}
+
+// jsonTypeName describes a flag value type in the terms of JSON.
+func jsonTypeName(valueType string) string {
+	if strings.HasSuffix(valueType, "s") {
+		return "array of " + valueType
+	}
+	return valueType
+}
+
+// A jsonTypeErr reports a JSON value that is not of the type a flag
+// expects.
+type jsonTypeErr struct {
+	expected string
+	// kind is the type of the value, or of its first wrong element
+	kind string
+	// index is the position of the first wrong element, or -1 if the value
+	// itself has the wrong type
+	index int
+}
+
+func (e *jsonTypeErr) Error() string {
+	if e.index >= 0 {
+		return fmt.Sprintf("expected %s, got %s at index %d", e.expected, e.kind, e.index)
+	}
+	return fmt.Sprintf("expected %s, got %s", e.expected, e.kind)
+}
+
+func jsonTypeError(expected string, raw json.RawMessage) error {
+	if elemType, isList := strings.CutPrefix(expected, "array of "); isList {
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err == nil {
+			elemType = strings.TrimSuffix(elemType, "s")
+			for i, elem := range elems {
+				if kind := jsonKind(elem); kind != elemType && !(elemType == "float" && kind == "int") {
+					return &jsonTypeErr{expected: expected, kind: kind, index: i}
+				}
+			}
+		}
+	}
+	return &jsonTypeErr{expected: expected, kind: jsonKind(raw), index: -1}
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(data []byte, offset int64) (int, int) {
+	line, column := 1, 1
+	for _, b := range data[:min(max(offset, 0), int64(len(data)))] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+// skipSeparators returns the offset of the next token at or after offset.
+// json.Decoder consumes whitespace and separators lazily, so its
+// InputOffset may point before them.
+func skipSeparators(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[offset]) != -1 {
+		offset++
+	}
+	return offset
+}
+
+// stripJsonc blanks out the comments and trailing commas of a JSONC file,
+// so it can be read as JSON. They are replaced with spaces, keeping line
+// breaks, so that positions in the result match the original file.
+func stripJsonc(data []byte) []byte {
+	out := bytes.Clone(data)
+	blank := func(start int, end int) {
+		for i := start; i < end; i++ {
+			if out[i] != '\n' && out[i] != '\r' {
+				out[i] = ' '
+			}
+		}
+	}
+
+	// Blank out comments, skipping over strings
+	for i := 0; i < len(out); i++ {
+		switch {
+		case out[i] == '"':
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+		case bytes.HasPrefix(out[i:], []byte("//")):
+			end := bytes.IndexByte(out[i:], '\n')
+			if end == -1 {
+				end = len(out) - i
+			}
+			blank(i, i+end)
+			i += end
+		case bytes.HasPrefix(out[i:], []byte("/*")):
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end == -1 {
+				// Leave it for the JSON parser to report
+				return out
+			}
+			blank(i, i+2+end+2)
+			i += 2 + end + 1
+		}
+	}
+
+	// Blank out commas that are followed by the end of an object or array
+	for i := 0; i < len(out); i++ {
+		switch out[i] {
+		case '"':
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+		case ',':
+			next := skipSeparators(out, int64(i+1))
+			if next < int64(len(out)) && (out[next] == '}' || out[next] == ']') && !bytes.Contains(out[i+1:next], []byte(",")) {
+				out[i] = ' '
+			}
+		}
+	}
+	return out
+}
+
+// parseJson reads the keys of a JSON config file, along with the position
+// of each key.
+func parseJson(data []byte) ([]configEntry, error) {
+	syntaxError := func(err error) error {
+		offset := int64(len(data))
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			// The offset points just past the offending character
+			offset = syntaxErr.Offset - 1
+		} else if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		line, column := position(data, offset)
+		return configError(line, column, "", fmt.Sprintf("Invalid JSON: %s", err))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+	if tok != json.Delim('{') {
+		return nil, configError(1, 1, "", "Invalid JSON: config must be an object")
+	}
+
+	var entries []configEntry
+	var readObject func(prefix string) error
+	readObject = func(prefix string) error {
+		for dec.More() {
+			offset := skipSeparators(data, dec.InputOffset())
+			tok, err := dec.Token()
+			if err != nil {
+				return syntaxError(err)
+			}
+			key := prefix + tok.(string)
+			line, column := position(data, offset)
+
+			// Flatten nested objects into keys like "server.port"
+			valueOffset := skipSeparators(data, dec.InputOffset())
+			if valueOffset < int64(len(data)) && data[valueOffset] == '{' && isNestedConfig(key) {
+				if _, err := dec.Token(); err != nil {
+					return syntaxError(err)
+				}
+				count := len(entries)
+				if err := readObject(key + "."); err != nil {
+					return err
+				}
+				if len(entries) == count {
+					entries = append(entries, configEntry{key: key, section: true, line: line, column: column})
+				}
+				if _, err := dec.Token(); err != nil {
+					return syntaxError(err)
+				}
+				continue
+			}
+
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return syntaxError(err)
+			}
+			entries = append(entries, configEntry{key: key, raw: raw, line: line, column: column})
+		}
+		return nil
+	}
+	if err := readObject(""); err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, syntaxError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		line, column := position(data, skipSeparators(data, dec.InputOffset()))
+		return nil, configError(line, column, "", "Invalid JSON: unexpected data after config object")
+	}
+
+	return entries, nil
+}
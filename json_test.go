@@ -0,0 +1,152 @@
+package gears
+
+import (
+	"log"
+	"testing"
+)
+
+func TestParseJson(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadConfigData(t, "config.json", "json", []byte("{\n  \"port\": 8080,\n  \"tags\": [\"a\", \"b\"]\n}"), "error"); err != nil {
+		t.Errorf("parseJson failed on valid config: %v", err)
+	}
+	if IntValue("port") != 8080 {
+		t.Error("port was not set from JSON")
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"{\n  \"port\": \"80\"\n}", `config.json:2:3: "port": expected int, got string`},
+		{"{\"port\": 1.5}", `config.json:1:2: "port": expected int, got float`},
+		{"{\"tags\": [\"a\", 1]}", `config.json:1:2: "tags": expected array of strings, got int at index 1`},
+		{"{\n\n    \"prot\": 80}", `config.json:3:5: "prot": option does not exist`},
+		{"{\n  \"port\": 80,\n  \"tags\": x\n}", `config.json:3:11: Invalid JSON: invalid character 'x' looking for beginning of value`},
+		{"{\"port\": 80", `config.json:1:11: Invalid JSON: unexpected end of JSON input`},
+		{"[]", `config.json:1:1: Invalid JSON: config must be an object`},
+		{"{\"port\": null}", `config.json:1:2: "port": expected int, got null`},
+	}
+	for _, test := range tests {
+		err := loadConfigData(t, "config.json", "json", []byte(test.config), "error")
+		if err == nil || err.Error() != test.want {
+			t.Errorf("loadConfigData(json, %q) = %v; want %s", test.config, err, test.want)
+		}
+	}
+}
+
+func TestParseJsonUnknownKeys(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	config := []byte(`{"$schema": "./schema.json", "$comment": "hi", "plugin-key": 1, "port": 8080}`)
+	if err := loadConfigData(t, "config.json", "json", config, "error"); err == nil {
+		t.Error("unknown key with 'error' policy succeeded; expected failure")
+	}
+	if err := loadConfigData(t, "config.json", "json", config, "warn"); err != nil {
+		t.Errorf("unknown key with 'warn' policy failed: %v", err)
+	}
+	if err := loadConfigData(t, "config.json", "json", config, "ignore"); err != nil {
+		t.Errorf("unknown key with 'ignore' policy failed: %v", err)
+	}
+	if IntValue("port") != 8080 {
+		t.Error("port was not set alongside unknown keys")
+	}
+	if err := loadConfigData(t, "config.json", "json", []byte(`{"$schema": "./schema.json"}`), "error"); err != nil {
+		t.Errorf("$schema key with 'error' policy failed: %v", err)
+	}
+}
+
+func TestParseJsonc(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	config := `{
+  // The port to listen on
+  "port": 8080, /* not 80 */
+  "tags": [
+    "a//b",
+    "/*c*/", // trailing comma
+  ],
+}`
+	if err := loadConfigData(t, "config.jsonc", JSONC, []byte(config), "error"); err != nil {
+		t.Errorf("loadConfigData(jsonc) failed on valid config: %v", err)
+	}
+	if IntValue("port") != 8080 {
+		t.Error("port was not set from JSONC")
+	}
+	if tags := StringValues("tags"); len(tags) != 2 || tags[0] != "a//b" || tags[1] != "/*c*/" {
+		t.Errorf("tags is %v; expected [a//b /*c*/]", tags)
+	}
+	if err := loadConfigData(t, "config.jsonc", JSON, []byte(config), "error"); err == nil {
+		t.Error("loadConfigData(json) succeeded with comments; expected failure")
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"{\n  /* comment\n  spanning lines */\n  \"port\": \"80\"\n}", `config.jsonc:4:3: "port": expected int, got string`},
+		{"{\n  // comment\n  \"port\": 80,,\n}", `config.jsonc:3:13: Invalid JSON: invalid character ',' looking for beginning of value`},
+		{"{\"port\": 80 /* unterminated", `config.jsonc:1:13: Invalid JSON: invalid character '/' after object key:value pair`},
+	}
+	for _, test := range tests {
+		err := loadConfigData(t, "config.jsonc", JSONC, []byte(test.config), "error")
+		if err == nil || err.Error() != test.want {
+			t.Errorf("loadConfigData(jsonc, %q) = %v; want %s", test.config, err, test.want)
+		}
+	}
+}
+
+func TestParseJsonNested(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "server-tls-cert", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "server-port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	config := `{"server": {"tls": {"cert": "/etc/cert.pem"}, "port": 8080}}`
+	if err := loadConfigData(t, "config.json", JSON, []byte(config), "error"); err != nil {
+		t.Errorf("parseConfig failed on nested config: %v", err)
+	}
+	if StringValue("server-tls-cert") != "/etc/cert.pem" || IntValue("server-port") != 8080 {
+		t.Error("nested keys were not mapped onto dashed flag names")
+	}
+	if err := loadConfigData(t, "config.json", JSON, []byte(`{"server.tls.cert": "/etc/other.pem", "server": {"port": 443}}`), "error"); err != nil {
+		t.Errorf("parseConfig failed on dotted keys: %v", err)
+	}
+	if StringValue("server-tls-cert") != "/etc/other.pem" || IntValue("server-port") != 443 {
+		t.Error("dotted keys were not mapped onto dashed flag names")
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"{\"server\": {\n  \"tls\": {\"crt\": \"x\"}}}", `config.json:2:11: "server.tls.crt": option does not exist`},
+		{"{\"server\": {\"port\": {\"value\": 80}}}", `config.json:1:13: "server.port": expected int, got object`},
+		{"{\"server.tls\": {\"cert\": 1}}", `config.json:1:17: "server.tls.cert": expected string, got int`},
+	}
+	for _, test := range tests {
+		err := loadConfigData(t, "config.json", JSON, []byte(test.config), "error")
+		if err == nil || err.Error() != test.want {
+			t.Errorf("loadConfigData(json, %q) = %v; want %s", test.config, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package gears
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// matchConditions are the conditions of a match block, which applies only
+// when all of them match. Each is a glob pattern.
+type matchConditions struct {
+	// Hostname matches the name of the machine
+	Hostname string `json:"hostname"`
+	// Exe matches the file name of the running program
+	Exe string `json:"exe"`
+	// Env matches the values of environment variables, including those
+	// from .env files, which must be set
+	Env map[string]string `json:"env"`
+	// Flag matches the values of flags, as set by args, the environment or
+	// the config files loaded so far, in that order of precedence
+	Flag map[string]string `json:"flag"`
+}
+
+var hostname = os.Hostname
+
+// splitMatches separates the "match" key of a config file from the rest of
+// its keys, unless there is a flag named "match".
+func splitMatches(entries []configEntry) ([]configEntry, []configEntry) {
+	if _, exists := flags["match"]; exists {
+		return entries, nil
+	}
+	var rest []configEntry
+	var matches []configEntry
+	for _, entry := range entries {
+		if entry.key == "match" {
+			matches = append(matches, entry)
+		} else {
+			rest = append(rest, entry)
+		}
+	}
+	return rest, matches
+}
+
+// applyMatches applies each block of a "match" key whose conditions match,
+// in order. Conditions see the program's args and the variables of .env
+// files, like the flags do. Keys in a block are reported at the position of
+// the "match" key.
+func applyMatches(match configEntry, policy string, args []string, dotEnv map[string]dotEnvValue) error {
+	fail := func(label string, message string) *ConfigError {
+		return configError(match.line, match.column, "", fmt.Sprintf("\"%s\": %s", label, message))
+	}
+
+	var blocks []json.RawMessage
+	if match.text != nil || json.Unmarshal(match.raw, &blocks) != nil {
+		kind := "string"
+		if match.section {
+			kind = "object"
+		} else if match.text == nil {
+			kind = jsonKind(match.raw)
+		}
+		return fail("match", "expected array of objects, got "+kind)
+	}
+
+	exe := ""
+	if len(args) != 0 {
+		exe = filepath.Base(args[0])
+	}
+
+	source := currentSource
+	var errs ConfigErrors
+	for i, raw := range blocks {
+		label := fmt.Sprintf("match[%d]", i)
+		var block map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &block); err != nil {
+			errs = append(errs, fail(label, "expected object, got "+jsonKind(raw)))
+			continue
+		}
+		when, exists := block["when"]
+		if !exists {
+			errs = append(errs, fail(label, "expected a \"when\" key with the conditions of the block"))
+			continue
+		}
+		var conditions matchConditions
+		dec := json.NewDecoder(bytes.NewReader(when))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&conditions); err != nil {
+			errs = append(errs, fail(label+".when", fmt.Sprintf("expected hostname, exe, env or flag conditions: %s", err)))
+			continue
+		}
+		matched, err := conditions.match(exe, dotEnv)
+		if err != nil {
+			errs = append(errs, fail(label+".when", err.Error()))
+			continue
+		}
+		if !matched {
+			continue
+		}
+
+		entries, err := parseJson(raw)
+		if err != nil {
+			errs.collect(err)
+			continue
+		}
+		entries = slices.DeleteFunc(entries, func(entry configEntry) bool {
+			return entry.key == "when" || strings.HasPrefix(entry.key, "when.")
+		})
+		for j := range entries {
+			entries[j].label = label + "." + entries[j].key
+			entries[j].line = match.line
+			entries[j].column = match.column
+		}
+
+		// Each block is a layer, so later blocks take precedence
+		beginLayer("config", source.Location)
+		currentSource.IncludedFrom = source.IncludedFrom
+		currentSource.Block = label
+		errs.collect(applyConfig(entries, policy))
+	}
+	return errs.err()
+}
+
+// match reports whether every condition matches, for the program named exe.
+func (c *matchConditions) match(exe string, dotEnv map[string]dotEnvValue) (bool, error) {
+	globMatch := func(pattern string, value string) (bool, error) {
+		matched, err := path.Match(pattern, value)
+		if err != nil {
+			return false, fmt.Errorf("pattern '%s' is invalid", pattern)
+		}
+		return matched, nil
+	}
+
+	var checks [][2]string
+	if c.Hostname != "" {
+		name, err := hostname()
+		if err != nil {
+			return false, fmt.Errorf("could not determine hostname: %s", err)
+		}
+		checks = append(checks, [2]string{c.Hostname, name})
+	}
+	if c.Exe != "" {
+		checks = append(checks, [2]string{c.Exe, exe})
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Env)) {
+		value, _, exists := lookupEnv(name, dotEnv)
+		if !exists {
+			return false, nil
+		}
+		checks = append(checks, [2]string{c.Env[name], value})
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Flag)) {
+		if _, exists := flags[name]; !exists {
+			return false, fmt.Errorf("flag '%s' does not exist", name)
+		}
+		value := values[name]
+		if ahead, exists := readAhead[name]; exists {
+			value = ahead.value
+		}
+		checks = append(checks, [2]string{c.Flag[name], fmt.Sprint(value)})
+	}
+
+	for _, check := range checks {
+		matched, err := globMatch(check[0], check[1])
+		if !matched || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,182 @@
+package gears
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "cache-dir", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "proxy", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "region", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+
+	defer func(original func() (string, error)) { hostname = original }(hostname)
+	hostname = func() (string, error) { return "build-01.example.com", nil }
+	isolateEnv(t)
+	t.Setenv("GEARS_TEST_CI", "true")
+
+	dir := t.TempDir()
+	writeConfigFiles(dir, map[string]string{
+		"config.json": `{
+  "cache-dir": "~/.cache/app",
+  "region": "eu-west",
+  "match": [
+    {"when": {"env": {"GEARS_TEST_CI": "true"}}, "cache-dir": "/tmp/cache", "port": 1},
+    {"when": {"hostname": "build-*"}, "proxy": "http://proxy:3128"},
+    {"when": {"hostname": "web-*"}, "proxy": "http://other:3128"},
+    {"when": {"flag": {"region": "eu-*"}, "exe": "*.test"}, "port": 2},
+    {"when": {"env": {"GEARS_TEST_MISSING": "*"}}, "port": 3},
+    {"when": {"env": {"GEARS_TEST_DOTENV": "yes"}}, "region": "us-east"}
+  ]
+}`,
+		".env": "GEARS_TEST_DOTENV=yes\n",
+	})
+	AddConfigFile(filepath.Join(dir, "config.json"))
+	AddDotEnvFile(filepath.Join(dir, ".env"))
+	if err := load("/usr/bin/app.test"); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if StringValue("cache-dir") != "/tmp/cache" {
+		t.Error("env match block was not applied")
+	}
+	if StringValue("proxy") != "http://proxy:3128" {
+		t.Error("hostname match block was not applied, or a non-matching block was")
+	}
+	if IntValue("port") != 2 {
+		t.Error("later match block did not take precedence")
+	}
+	if source := SourceOf("port"); source.Block != "match[3]" {
+		t.Errorf("port has source %v; expected match[3]", source)
+	}
+	if StringValue("region") != "us-east" {
+		t.Error("env match block did not see a variable from a .env file")
+	}
+}
+
+func TestMatchToml(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "proxy", ValueType: "string", DefaultValue: ""}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+
+	defer func(original func() (string, error)) { hostname = original }(hostname)
+	hostname = func() (string, error) { return "build-01.example.com", nil }
+	isolateEnv(t)
+
+	dir := t.TempDir()
+	writeConfigFiles(dir, map[string]string{
+		"config.toml": `port = 1
+
+[[match]]
+when = {hostname = "build-*"}
+proxy = "http://proxy:3128"
+
+[[match]]
+port = 2
+
+[match.when]
+hostname = "*.example.com"
+`,
+	})
+	AddConfigFile(filepath.Join(dir, "config.toml"))
+	if err := load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if StringValue("proxy") != "http://proxy:3128" {
+		t.Error("first [[match]] block was not applied")
+	}
+	if IntValue("port") != 2 {
+		t.Error("second [[match]] block was not applied")
+	}
+	if source := SourceOf("port"); source.Block != "match[1]" {
+		t.Errorf("port has source %v; expected match[1]", source)
+	}
+}
+
+func TestMatchFlagOutsideConfig(t *testing.T) {
+	config := `{"stage": "dev", "match": [{"when": {"flag": {"stage": "prod"}}, "port": 443}]}`
+	tests := []struct {
+		env  string
+		args []string
+		want int
+	}{
+		{"", []string{"program"}, 80},
+		{"", []string{"program", "--stage", "prod"}, 443},
+		{"prod", []string{"program"}, 443},
+		{"prod", []string{"program", "--stage", "dev"}, 80},
+	}
+	for _, test := range tests {
+		tests_reset()
+		if err := Add(&Flag{Name: "stage", ValueType: "string", DefaultValue: ""}); err != nil {
+			log.Fatal(err)
+		}
+		if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+			log.Fatal(err)
+		}
+		isolateEnv(t)
+		if test.env != "" {
+			t.Setenv("STAGE", test.env)
+		}
+		dir := t.TempDir()
+		writeConfigFiles(dir, map[string]string{"config.json": config})
+		AddConfigFile(filepath.Join(dir, "config.json"))
+
+		err := load(test.args...)
+		os.Unsetenv("STAGE")
+		if err != nil {
+			t.Errorf("load(%q) with STAGE=%q failed: %v", test.args, test.env, err)
+			continue
+		}
+		if IntValue("port") != test.want {
+			t.Errorf("load(%q) with STAGE=%q set port to %d; expected %d", test.args, test.env, IntValue("port"), test.want)
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"{\n  \"match\": 1\n}", `config.json:2:3: "match": expected array of objects, got int`},
+		{`{"match": [1]}`, `config.json:1:2: "match[0]": expected object, got int`},
+		{`{"match": [{"port": 1}]}`, `config.json:1:2: "match[0]": expected a "when" key with the conditions of the block`},
+		{`{"match": [{"when": {"host": "x"}}]}`, `config.json:1:2: "match[0].when": expected hostname, exe, env or flag conditions: json: unknown field "host"`},
+		{`{"match": [{"when": {"flag": {"prot": "x"}}}]}`, `config.json:1:2: "match[0].when": flag 'prot' does not exist`},
+		{`{"match": [{"when": {"exe": "["}}]}`, `config.json:1:2: "match[0].when": pattern '[' is invalid`},
+		{`{"match": [{"when": {}, "port": "80"}]}`, `config.json:1:2: "match[0].port": expected int, got string`},
+	}
+	for _, test := range tests {
+		tests_reset()
+		if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+			log.Fatal(err)
+		}
+		isolateEnv(t)
+		dir := t.TempDir()
+		writeConfigFiles(dir, map[string]string{"config.json": test.config})
+		path := filepath.Join(dir, "config.json")
+		AddConfigFile(path)
+		err := load()
+		if err == nil || strings.ReplaceAll(err.Error(), path, "config.json") != test.want {
+			t.Errorf("load(%q) = %v; want %s", test.config, err, test.want)
+		}
+	}
+}
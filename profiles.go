@@ -0,0 +1,221 @@
+package gears
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// A configBlock is a section of a config file that is applied on top of
+// the config files, such as a profile.
+type configBlock struct {
+	source  Source
+	policy  string
+	inherit *configEntry
+	entries []configEntry
+}
+
+var profilesEnabled bool
+
+// profiles holds the blocks of each profile, in the order they were read
+var profiles map[string][]*configBlock
+
+// EnableProfiles adds the built-in --profile flag, which selects one of the
+// profiles in the "profiles" section of config files. The profile can also
+// be selected by the flag's environment variable, such as PROFILE, or a
+// "profile" key in a config file. A string flag named "profile" that was
+// already added, such as one with a shorthand, is used instead.
+func EnableProfiles() error {
+	if flag, exists := flags["profile"]; exists {
+		if flag.ValueType != "string" {
+			return fmt.Errorf("Flag 'profile' must be of type string to select profiles!")
+		}
+	} else if err := Add(&Flag{
+		Name:         "profile",
+		ValueType:    "string",
+		DefaultValue: "",
+		Description:  "The config profile to use",
+	}); err != nil {
+		return err
+	}
+	profilesEnabled = true
+	return nil
+}
+
+// Profiles returns the names of the profiles in the config files that
+// exist, and in the files they include. Files are read again on every call,
+// so it may be used before loading, as usage does. Files that can't be read
+// are skipped.
+func Profiles() []string {
+	names := make(map[string]bool)
+	for _, file := range configFiles {
+		if fileExists(file.path) {
+			findProfiles(file, nil, names)
+		}
+	}
+	return slices.Sorted(maps.Keys(names))
+}
+
+func findProfiles(file *configFile, chain []string, names map[string]bool) {
+	data, err := os.ReadFile(file.path)
+	if err != nil {
+		return
+	}
+	entries, err := readConfig(formatOf(file, data), data, file.options)
+	if err != nil {
+		return
+	}
+	entries, includes := splitIncludes(entries)
+	chain = append(slices.Clone(chain), file.path)
+	for _, include := range includes {
+		paths, _ := includePaths(file.path, include)
+		for _, path := range paths {
+			if !isIncluded(path, chain) {
+				findProfiles(&configFile{path: path}, chain, names)
+			}
+		}
+	}
+	for _, entry := range entries {
+		if path, isProfile := strings.CutPrefix(entry.key, "profiles."); isProfile {
+			name, _, _ := strings.Cut(path, ".")
+			names[name] = true
+		}
+	}
+}
+
+// splitProfiles separates the keys of the "profiles" section of a config
+// file from the rest of its keys, and records them for applyProfile.
+func splitProfiles(entries []configEntry, policy string) ([]configEntry, error) {
+	if !profilesEnabled {
+		return entries, nil
+	}
+	if profiles == nil {
+		profiles = make(map[string][]*configBlock)
+	}
+
+	var rest []configEntry
+	var errs ConfigErrors
+	blocks := make(map[string]*configBlock)
+	for _, entry := range entries {
+		path, isProfile := strings.CutPrefix(entry.key, "profiles.")
+		if !isProfile {
+			rest = append(rest, entry)
+			continue
+		}
+		name, key, isKey := strings.Cut(path, ".")
+		if !isKey && !entry.section {
+			errs = append(errs, configError(entry.line, entry.column, "", fmt.Sprintf("\"%s\": expected object, got %s", entry.key, jsonKind(entry.raw))))
+			continue
+		}
+
+		// An empty profile still exists, so it can be selected
+		block, exists := blocks[name]
+		if !exists {
+			source := currentSource
+			source.Block = "profiles." + name
+			block = &configBlock{source: source, policy: policy}
+			blocks[name] = block
+			profiles[name] = append(profiles[name], block)
+		}
+		entry.label = entry.key
+		entry.key = key
+		if !isKey {
+			continue
+		}
+		if key == "inherit" {
+			block.inherit = &entry
+		} else {
+			block.entries = append(block.entries, entry)
+		}
+	}
+	return rest, errs.err()
+}
+
+// errorAt creates an error at an entry of the block, in the config file
+// that defined it. The layer being loaded is left as it is.
+func (block *configBlock) errorAt(entry *configEntry, message string) *ConfigError {
+	source := currentSource
+	defer func() { currentSource = source }()
+	currentSource = block.source
+	return configError(entry.line, entry.column, "", message)
+}
+
+// selectedProfile returns the profile chosen by the --profile argument, the
+// environment or a config file, in that order of precedence.
+func selectedProfile() (string, Source) {
+	if ahead, exists := readAhead["profile"]; exists {
+		return ahead.value.(string), ahead.source
+	}
+	return values["profile"].(string), sources["profile"]
+}
+
+// inheritOf returns the profile a profile inherits from. If several config
+// files set it, the last one wins.
+func inheritOf(name string) (string, *configBlock, error) {
+	for _, block := range slices.Backward(profiles[name]) {
+		if block.inherit == nil {
+			continue
+		}
+		entry := block.inherit
+		var parent string
+		if entry.text != nil {
+			parent = *entry.text
+		} else if err := json.Unmarshal(entry.raw, &parent); err != nil {
+			return "", block, block.errorAt(entry, fmt.Sprintf("\"%s\": expected string, got %s", entry.label, jsonKind(entry.raw)))
+		}
+		return parent, block, nil
+	}
+	return "", nil, nil
+}
+
+// applyProfile applies the selected profile on top of the config files,
+// after the profiles it inherits from.
+func applyProfile() error {
+	if !profilesEnabled {
+		return nil
+	}
+	name, source := selectedProfile()
+	if name == "" {
+		return nil
+	}
+	if _, exists := profiles[name]; !exists {
+		return &ConfigError{
+			Flag:     "profile",
+			Source:   source.Kind,
+			Location: source.Location,
+			Message:  fmt.Sprintf("Profile '%s' does not exist! Available profiles: %s", name, strings.Join(slices.Sorted(maps.Keys(profiles)), ", ")),
+		}
+	}
+
+	var chain []string
+	for profile := name; profile != ""; {
+		chain = append(chain, profile)
+		parent, block, err := inheritOf(profile)
+		if err == nil && parent != "" {
+			if slices.Contains(chain, parent) {
+				err = block.errorAt(block.inherit, fmt.Sprintf("\"%s\": profile '%s' inherits from itself", block.inherit.label, parent))
+			} else if _, exists := profiles[parent]; !exists {
+				err = block.errorAt(block.inherit, fmt.Sprintf("\"%s\": profile '%s' does not exist", block.inherit.label, parent))
+			}
+		}
+		if err != nil {
+			return err
+		}
+		profile = parent
+	}
+
+	// Profiles take precedence over the profiles they inherit from
+	var errs ConfigErrors
+	for _, profile := range slices.Backward(chain) {
+		for _, block := range profiles[profile] {
+			beginLayer("config", block.source.Location)
+			currentSource.IncludedFrom = block.source.IncludedFrom
+			currentSource.Block = block.source.Block
+			errs.collect(applyConfig(block.entries, block.policy))
+		}
+	}
+	return errs.err()
+}
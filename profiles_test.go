@@ -0,0 +1,286 @@
+package gears
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupProfiles(t *testing.T, files map[string]string) string {
+	tests_reset()
+
+	if err := EnableProfiles(); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80, Description: "Port"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "host", ValueType: "string", DefaultValue: "", Description: "Host"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "debug", ValueType: "bool", Description: "Debug"}); err != nil {
+		log.Fatal(err)
+	}
+	isolateEnv(t)
+
+	dir := t.TempDir()
+	writeConfigFiles(dir, files)
+	return dir
+}
+
+func TestProfiles(t *testing.T) {
+	dir := setupProfiles(t, map[string]string{
+		"config.json": `{
+  "host": "localhost",
+  "port": 8000,
+  "profiles": {
+    "staging": {"host": "staging.example.com", "debug": true},
+    "prod": {"inherit": "staging", "host": "example.com", "port": 443}
+  }
+}`,
+		"local.toml": "[profiles.prod]\nport = 8443\n",
+	})
+	AddConfigFile(filepath.Join(dir, "config.json"))
+	AddConfigFile(filepath.Join(dir, "local.toml"))
+
+	if err := load("program"); err != nil {
+		t.Fatalf("load without profile failed: %v", err)
+	}
+	if StringValue("host") != "localhost" || IntValue("port") != 8000 {
+		t.Error("profile was applied without being selected")
+	}
+
+	t.Setenv("PORT", "9000")
+	if err := load("program", "--profile", "prod"); err != nil {
+		t.Fatalf("load with profile failed: %v", err)
+	}
+	if StringValue("host") != "example.com" {
+		t.Error("profile did not take precedence over the base config")
+	}
+	if !BoolValue("debug") {
+		t.Error("profile did not inherit from its parent")
+	}
+	if IntValue("port") != 9000 {
+		t.Error("environment variable did not take precedence over profile")
+	}
+	if StringValue("profile") != "prod" {
+		t.Error("profile flag was not set from args")
+	}
+	if source := SourceOf("host"); source.Block != "profiles.prod" {
+		t.Errorf("host has source %v; expected profiles.prod", source)
+	}
+
+	os.Unsetenv("PORT")
+	t.Setenv("PROFILE", "prod")
+	if err := load("program"); err != nil {
+		t.Fatalf("load with profile from env failed: %v", err)
+	}
+	if IntValue("port") != 8443 {
+		t.Error("later config file did not take precedence within profile")
+	}
+
+	var buf bytes.Buffer
+	FprintUsage(&buf)
+	if !strings.HasSuffix(buf.String(), "\nProfiles: prod, staging\n") {
+		t.Errorf("usage did not list profiles:\n%s", buf.String())
+	}
+}
+
+func TestProfileFromConfig(t *testing.T) {
+	dir := setupProfiles(t, map[string]string{
+		"config.yaml": "profile: dev\nport: 1\nprofiles:\n  dev:\n    port: 2\n",
+	})
+	AddConfigFile(filepath.Join(dir, "config.yaml"))
+
+	if err := load("program"); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if IntValue("port") != 2 {
+		t.Error("profile selected by config file was not applied")
+	}
+}
+
+func TestProfileLayers(t *testing.T) {
+	files := map[string]string{
+		"0.json": `{"profiles": {"base": {"host": "base"}, "prod": {"inherit": "base", "port": 443}}}`,
+	}
+	for i := 1; i <= 8; i++ {
+		files[fmt.Sprintf("%d.json", i)] = fmt.Sprintf(`{"port": %d}`, i)
+	}
+	files["8.json"] = `{"port": 8, "json": true}`
+	dir := setupProfiles(t, files)
+	for i := 0; i <= 8; i++ {
+		AddConfigFile(filepath.Join(dir, fmt.Sprintf("%d.json", i)))
+	}
+	flags["port"].Repeat = "error"
+	if err := Add(&Flag{Name: "json", ValueType: "bool"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "yaml", ValueType: "bool"}); err != nil {
+		log.Fatal(err)
+	}
+	MutuallyExclusive("json", "yaml")
+	isolateEnv(t)
+	t.Setenv("PORT", "9000")
+
+	// Applying an inheriting profile must not move later layers below the
+	// config files
+	if err := load("program", "--profile", "prod", "--yaml"); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if IntValue("port") != 9000 {
+		t.Error("environment variable did not take precedence over the config files")
+	}
+	if !BoolValue("yaml") || BoolValue("json") {
+		t.Error("args did not take precedence over the config files")
+	}
+	if StringValue("host") != "base" {
+		t.Error("profile did not inherit from its parent")
+	}
+}
+
+func TestEmptyProfiles(t *testing.T) {
+	for name, config := range map[string]string{
+		"config.json": `{"port": 1, "profiles": {"dev": {}}}`,
+		"config.yaml": "port: 1\nprofiles:\n  dev: {}\n",
+		"config.toml": "port = 1\n[profiles.dev]\n",
+		"config.ini":  "port = 1\n[profiles \"dev\"]\n",
+	} {
+		dir := setupProfiles(t, map[string]string{name: config})
+		AddConfigFile(filepath.Join(dir, name))
+
+		if profiles := Profiles(); len(profiles) != 1 || profiles[0] != "dev" {
+			t.Errorf("Profiles() = %q for %s; want [dev]", profiles, name)
+		}
+		if err := load("program", "--profile", "dev"); err != nil {
+			t.Errorf("load with empty profile from %s failed: %v", name, err)
+		} else if IntValue("port") != 1 {
+			t.Errorf("port was not set from %s with an empty profile", name)
+		}
+	}
+}
+
+func TestProfileFromArgs(t *testing.T) {
+	config := `{"port": 1, "profiles": {"dev": {"port": 2}, "prod": {"port": 3}}}`
+	tests := []struct {
+		args   []string
+		repeat string
+		want   int
+	}{
+		{[]string{"program", "--profile", "dev"}, "", 2},
+		{[]string{"program", "-p", "dev"}, "", 2},
+		// --profile is the value of --host here, not a flag
+		{[]string{"program", "--host", "--profile", "prod"}, "", 1},
+		{[]string{"program", "--", "--profile", "prod"}, "", 1},
+		{[]string{"program", "--profile", "dev", "-p", "prod"}, "", 3},
+		{[]string{"program", "--profile", "dev", "-p", "prod"}, "first-wins", 2},
+	}
+	for _, test := range tests {
+		tests_reset()
+		// An existing profile flag is used by EnableProfiles
+		if err := Add(&Flag{Name: "profile", Shorthand: "p", ValueType: "string", DefaultValue: ""}); err != nil {
+			log.Fatal(err)
+		}
+		if err := EnableProfiles(); err != nil {
+			log.Fatal(err)
+		}
+		if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+			log.Fatal(err)
+		}
+		if err := Add(&Flag{Name: "host", ValueType: "string", DefaultValue: ""}); err != nil {
+			log.Fatal(err)
+		}
+		isolateEnv(t)
+		dir := t.TempDir()
+		writeConfigFiles(dir, map[string]string{"config.json": config})
+		AddConfigFile(filepath.Join(dir, "config.json"))
+		if test.repeat != "" {
+			SetRepeat(test.repeat)
+		}
+
+		if err := load(test.args...); err != nil {
+			t.Errorf("load(%q) failed: %v", test.args, err)
+			continue
+		}
+		if IntValue("port") != test.want {
+			t.Errorf("load(%q) set port to %d; expected %d", test.args, IntValue("port"), test.want)
+		}
+	}
+}
+
+func TestProfilesUsage(t *testing.T) {
+	dir := setupProfiles(t, map[string]string{
+		"config.json":   `{"$include": "profiles.yaml", "profiles": {"dev": {"port": 1}}}`,
+		"profiles.yaml": "profiles:\n  prod:\n    port: 2\n",
+	})
+	AddConfigFile(filepath.Join(dir, "config.json"))
+
+	// Profiles are listed before the config files are loaded
+	var buf bytes.Buffer
+	FprintUsage(&buf)
+	if !strings.HasSuffix(buf.String(), "\nProfiles: dev, prod\n") {
+		t.Errorf("usage did not list profiles:\n%s", buf.String())
+	}
+}
+
+func TestEnableProfilesWrongType(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "profile", ValueType: "int", DefaultValue: 0}); err != nil {
+		log.Fatal(err)
+	}
+	if err := EnableProfiles(); err == nil {
+		t.Error("EnableProfiles accepted an int profile flag")
+	}
+	isolateEnv(t)
+	if err := load("program"); err != nil {
+		t.Errorf("load failed after EnableProfiles failed: %v", err)
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		args   []string
+		want   string
+	}{
+		{
+			`{"profiles": {"dev": {"port": 1}}}`,
+			[]string{"program", "--profile", "prod"},
+			"argument 2: Profile 'prod' does not exist! Available profiles: dev",
+		},
+		{
+			"{\"profiles\": {\n  \"a\": {\"inherit\": \"b\"},\n  \"b\": {\"inherit\": \"a\"}}}",
+			[]string{"program", "--profile", "a"},
+			`config.json:3:9: "profiles.b.inherit": profile 'a' inherits from itself`,
+		},
+		{
+			"{\"profiles\": {\"a\": {\"inherit\": \"c\"}}}",
+			[]string{"program", "--profile", "a"},
+			`config.json:1:21: "profiles.a.inherit": profile 'c' does not exist`,
+		},
+		{
+			"{\"profiles\": {\"a\": {\"port\": \"80\"}}}",
+			[]string{"program", "--profile", "a"},
+			`config.json:1:21: "profiles.a.port": expected int, got string`,
+		},
+		{
+			"{\"profiles\": {\"a\": 1}}",
+			[]string{"program"},
+			`config.json:1:15: "profiles.a": expected object, got int`,
+		},
+	}
+	for _, test := range tests {
+		dir := setupProfiles(t, map[string]string{"config.json": test.config})
+		path := filepath.Join(dir, "config.json")
+		AddConfigFile(path)
+		err := load(test.args...)
+		if err == nil || strings.ReplaceAll(err.Error(), path, "config.json") != test.want {
+			t.Errorf("load(%q) = %v; want %s", test.config, err, test.want)
+		}
+	}
+}
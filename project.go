@@ -0,0 +1,69 @@
+package gears
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ProjectConfigOptions change how a project config file is found.
+type ProjectConfigOptions struct {
+	// StopAt are names of files or directories, such as ".git", that mark
+	// the root of a project. The search does not go above the first
+	// directory containing one. Defaults to searching up to the root
+	// directory.
+	StopAt []string
+	// All adds every matching file, from the outermost directory to the
+	// innermost, instead of only the innermost one.
+	All bool
+}
+
+// AddProjectConfigFile adds the config file with the given name, such as
+// ".apprc.json", from the working directory or the nearest directory above
+// it.
+func AddProjectConfigFile(name string) {
+	AddProjectConfigFileWithOptions(name, ProjectConfigOptions{})
+}
+
+func AddProjectConfigFileWithOptions(name string, options ProjectConfigOptions) {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Println("Warning: Could not determine working directory")
+		return
+	}
+
+	var paths []string
+	for {
+		path := filepath.Join(dir, name)
+		if fileExists(path) {
+			paths = append(paths, path)
+			if !options.All {
+				break
+			}
+		}
+		if isProjectRoot(dir, options.StopAt) {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	// Inner files take precedence, so they are added last
+	slices.Reverse(paths)
+	for _, path := range paths {
+		AddConfigFile(path)
+	}
+}
+
+func isProjectRoot(dir string, stopAt []string) bool {
+	for _, marker := range stopAt {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package gears
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddProjectConfigFile(t *testing.T) {
+	root := t.TempDir()
+	inner := filepath.Join(root, "repo", "src", "pkg")
+	if err := os.MkdirAll(inner, 0755); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "repo", ".git"), 0755); err != nil {
+		log.Fatal(err)
+	}
+	// Keeps the search from leaving the temporary directory
+	if err := os.WriteFile(filepath.Join(root, ".testroot"), nil, 0644); err != nil {
+		log.Fatal(err)
+	}
+	for _, dir := range []string{root, filepath.Join(root, "repo"), filepath.Join(root, "repo", "src")} {
+		if err := os.WriteFile(filepath.Join(dir, ".apprc.json"), []byte("{}"), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(inner); err != nil {
+		log.Fatal(err)
+	}
+
+	tests := []struct {
+		options ProjectConfigOptions
+		want    []string
+	}{
+		{ProjectConfigOptions{}, []string{"repo/src"}},
+		{ProjectConfigOptions{All: true, StopAt: []string{".testroot"}}, []string{"", "repo", "repo/src"}},
+		{ProjectConfigOptions{All: true, StopAt: []string{".git", ".testroot"}}, []string{"repo", "repo/src"}},
+	}
+	for _, test := range tests {
+		tests_reset()
+		AddProjectConfigFileWithOptions(".apprc.json", test.options)
+		if len(configFiles) != len(test.want) {
+			t.Errorf("AddProjectConfigFileWithOptions(%+v) added %d files; expected %d", test.options, len(configFiles), len(test.want))
+			continue
+		}
+		for i, dir := range test.want {
+			if want := filepath.Join(root, dir, ".apprc.json"); configFiles[i].path != want {
+				t.Errorf("AddProjectConfigFileWithOptions(%+v) added %s at %d; expected %s", test.options, configFiles[i].path, i, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,607 @@
+package gears
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This is a small TOML reader. Tables and dotted keys are joined into
+// dashed flag names, so "[server] port = 80" sets the flag server-port.
+// Arrays of tables are only supported for match blocks, since no flag type
+// could hold them.
+
+type tomlParser struct {
+	data    string
+	pos     int
+	table   []string
+	entries []configEntry
+	defined map[string]bool
+	// matches are the tables of a "[[match]]" array, if any, and
+	// matchOffset is the position of the first of them
+	matches     [][]tomlKeyValue
+	matchOffset int
+	// header is the entry of the last table header, which is kept if the
+	// table has no keys, and count is the number of entries before it
+	header *configEntry
+	count  int
+}
+
+// A tomlKeyValue is a key from an inline table, which may itself hold a
+// table.
+type tomlKeyValue struct {
+	key    []string
+	raw    json.RawMessage
+	table  []tomlKeyValue
+	offset int
+}
+
+type tomlError struct {
+	offset  int
+	message string
+}
+
+func (e *tomlError) Error() string {
+	return e.message
+}
+
+func (p *tomlParser) errorf(offset int, format string, args ...any) error {
+	return &tomlError{offset: offset, message: fmt.Sprintf(format, args...)}
+}
+
+// parseToml reads the keys of a TOML config file, along with the position of
+// each key.
+func parseToml(data []byte) ([]configEntry, error) {
+	p := &tomlParser{data: string(data), defined: make(map[string]bool)}
+	if err := p.parse(); err != nil {
+		tomlErr := err.(*tomlError)
+		line, column := position(data, int64(tomlErr.offset))
+		return nil, configError(line, column, "", "Invalid TOML: "+tomlErr.message)
+	}
+	return p.entries, nil
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		p.skipBlank(true)
+		if p.pos >= len(p.data) {
+			p.endTable()
+			return p.addMatches()
+		}
+
+		start := p.pos
+		if p.data[p.pos] == '[' {
+			p.endTable()
+		}
+		if strings.HasPrefix(p.data[p.pos:], "[[") {
+			if err := p.parseMatchHeader(); err != nil {
+				return err
+			}
+		} else if p.data[p.pos] == '[' {
+			p.pos++
+			p.skipBlank(false)
+			key, err := p.parseKey()
+			if err != nil {
+				return err
+			}
+			p.skipBlank(false)
+			if p.pos >= len(p.data) || p.data[p.pos] != ']' {
+				return p.errorf(p.pos, "expected ']' after table name")
+			}
+			p.pos++
+			name := strings.Join(key, ".")
+			if p.matches != nil && key[0] == "match" {
+				if len(key) == 1 {
+					return p.errorf(start, "table 'match' is defined more than once")
+				}
+				// A table inside the last match block, such as
+				// "[match.when]"
+				name = fmt.Sprintf("match[%d]%s", len(p.matches)-1, name[len("match"):])
+			}
+			if p.defined["["+name] || p.defined[name] {
+				return p.errorf(start, "table '%s' is defined more than once", name)
+			}
+			p.defined["["+name] = true
+			p.table = key
+			if p.matches == nil || key[0] != "match" {
+				line, column := position([]byte(p.data), int64(start))
+				p.header = &configEntry{key: name, section: true, line: line, column: column}
+				p.count = len(p.entries)
+			}
+		} else {
+			kv, err := p.parseKeyValue()
+			if err != nil {
+				return err
+			}
+			if p.matches != nil && len(p.table) != 0 && p.table[0] == "match" {
+				last := len(p.matches) - 1
+				kv.key = append(append([]string{}, p.table[1:]...), kv.key...)
+				name := fmt.Sprintf("match[%d].%s", last, strings.Join(kv.key, "."))
+				if p.defined[name] || p.defined["["+name] {
+					return p.errorf(kv.offset, "key '%s' is defined more than once", name)
+				}
+				p.defined[name] = true
+				p.matches[last] = append(p.matches[last], kv)
+			} else if err := p.add(p.table, kv); err != nil {
+				return err
+			}
+		}
+
+		if err := p.endLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// endTable keeps the header of the last table if it has no keys.
+func (p *tomlParser) endTable() {
+	if p.header != nil && len(p.entries) == p.count {
+		p.entries = append(p.entries, *p.header)
+	}
+	p.header = nil
+}
+
+// parseMatchHeader parses "[[match]]", which starts a new match block.
+// Other arrays of tables are not supported.
+func (p *tomlParser) parseMatchHeader() error {
+	start := p.pos
+	p.pos += 2
+	p.skipBlank(false)
+	key, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if !strings.HasPrefix(p.data[p.pos:], "]]") {
+		return p.errorf(p.pos, "expected ']]' after table name")
+	}
+	p.pos += 2
+	if _, exists := flags["match"]; exists || len(key) != 1 || key[0] != "match" {
+		return p.errorf(start, "arrays of tables are not supported, except for [[match]]")
+	}
+
+	if p.matches == nil {
+		defined := p.defined["[match"]
+		for _, entry := range p.entries {
+			defined = defined || entry.key == "match" || strings.HasPrefix(entry.key, "match.")
+		}
+		if defined {
+			return p.errorf(start, "key 'match' is defined more than once")
+		}
+		p.defined["match"] = true
+		p.defined["[match"] = true
+		p.matchOffset = start
+	}
+	p.matches = append(p.matches, []tomlKeyValue{})
+	p.table = key
+	return nil
+}
+
+// addMatches records the tables of a "[[match]]" array as a single "match"
+// key holding an array, like an inline array of tables.
+func (p *tomlParser) addMatches() error {
+	if p.matches == nil {
+		return nil
+	}
+	raw := []byte{'['}
+	for i, table := range p.matches {
+		object, err := tomlTableJSON(table)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			raw = append(raw, ',')
+		}
+		raw = append(raw, object...)
+	}
+	raw = append(raw, ']')
+
+	line, column := position([]byte(p.data), int64(p.matchOffset))
+	p.entries = append(p.entries, configEntry{key: "match", raw: raw, line: line, column: column})
+	return nil
+}
+
+// add records a key, flattening any tables it holds.
+func (p *tomlParser) add(prefix []string, kv tomlKeyValue) error {
+	key := append(append([]string{}, prefix...), kv.key...)
+	if kv.table != nil {
+		for _, sub := range kv.table {
+			if err := p.add(key, sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	name := strings.Join(key, ".")
+	if p.defined[configFlagName(name)] {
+		return p.errorf(kv.offset, "key '%s' is defined more than once", name)
+	}
+	p.defined[configFlagName(name)] = true
+
+	line, column := position([]byte(p.data), int64(kv.offset))
+	p.entries = append(p.entries, configEntry{key: name, raw: kv.raw, line: line, column: column})
+	return nil
+}
+
+// skipBlank skips whitespace and comments, and newlines if multiline is
+// true.
+func (p *tomlParser) skipBlank(multiline bool) {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case (c == '\n' || c == '\r') && multiline:
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endLine() error {
+	p.skipBlank(false)
+	if p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+		return p.errorf(p.pos, "expected the end of the line")
+	}
+	return nil
+}
+
+func isTomlBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseKey parses a dotted key such as server."tls".cert.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var key []string
+	for {
+		p.skipBlank(false)
+		if p.pos >= len(p.data) {
+			return nil, p.errorf(p.pos, "expected a key")
+		}
+
+		switch c := p.data[p.pos]; {
+		case c == '"' || c == '\'':
+			if strings.HasPrefix(p.data[p.pos:], `"""`) || strings.HasPrefix(p.data[p.pos:], `'''`) {
+				return nil, p.errorf(p.pos, "keys cannot be multi-line strings")
+			}
+			part, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			key = append(key, part)
+		case isTomlBareKeyChar(c):
+			start := p.pos
+			for p.pos < len(p.data) && isTomlBareKeyChar(p.data[p.pos]) {
+				p.pos++
+			}
+			key = append(key, p.data[start:p.pos])
+		default:
+			return nil, p.errorf(p.pos, "expected a key")
+		}
+
+		p.skipBlank(false)
+		if p.pos >= len(p.data) || p.data[p.pos] != '.' {
+			return key, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseKeyValue() (tomlKeyValue, error) {
+	offset := p.pos
+	key, err := p.parseKey()
+	if err != nil {
+		return tomlKeyValue{}, err
+	}
+	p.skipBlank(false)
+	if p.pos >= len(p.data) || p.data[p.pos] != '=' {
+		return tomlKeyValue{}, p.errorf(p.pos, "expected '=' after key")
+	}
+	p.pos++
+	p.skipBlank(false)
+
+	kv := tomlKeyValue{key: key, offset: offset}
+	if p.pos < len(p.data) && p.data[p.pos] == '{' {
+		kv.table, err = p.parseInlineTable()
+	} else {
+		kv.raw, err = p.parseValue()
+	}
+	return kv, err
+}
+
+func (p *tomlParser) parseInlineTable() ([]tomlKeyValue, error) {
+	p.pos++
+	table := []tomlKeyValue{}
+	for {
+		p.skipBlank(false)
+		if p.pos < len(p.data) && p.data[p.pos] == '}' && len(table) == 0 {
+			p.pos++
+			return table, nil
+		}
+
+		kv, err := p.parseKeyValue()
+		if err != nil {
+			return nil, err
+		}
+		table = append(table, kv)
+
+		p.skipBlank(false)
+		if p.pos >= len(p.data) {
+			return nil, p.errorf(p.pos, "unterminated inline table")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, p.errorf(p.pos, "expected ',' or '}' in inline table")
+		}
+	}
+}
+
+// tomlTableJSON converts an inline table to a JSON object, for tables that
+// are inside arrays.
+func tomlTableJSON(table []tomlKeyValue) (json.RawMessage, error) {
+	object := make(map[string]any)
+	for _, kv := range table {
+		parent := object
+		for _, part := range kv.key[:len(kv.key)-1] {
+			child, ok := parent[part].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				parent[part] = child
+			}
+			parent = child
+		}
+		last := kv.key[len(kv.key)-1]
+		if kv.table != nil {
+			raw, err := tomlTableJSON(kv.table)
+			if err != nil {
+				return nil, err
+			}
+			parent[last] = raw
+		} else {
+			parent[last] = kv.raw
+		}
+	}
+	return json.Marshal(object)
+}
+
+var tomlDatePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?)?|\d{2}:\d{2}(:\d{2}(\.\d+)?)?)([Zz]|[-+]\d{2}:\d{2})?`)
+var tomlNumberPattern = regexp.MustCompile(`^[-+]?(0x[0-9a-fA-F_]+|0o[0-7_]+|0b[01_]+|inf|nan|[0-9_]+(\.[0-9_]+)?([eE][-+]?[0-9_]+)?)`)
+
+// parseValue parses a value other than an inline table, converting it to
+// JSON. Dates and times become strings.
+func (p *tomlParser) parseValue() (json.RawMessage, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf(p.pos, "expected a value")
+	}
+
+	rest := p.data[p.pos:]
+	switch c := rest[0]; {
+	case c == '"' || c == '\'':
+		start := p.pos
+		value, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.ValidString(value) {
+			return nil, p.errorf(start, "string is not valid UTF-8")
+		}
+		return json.Marshal(value)
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		table, err := p.parseInlineTable()
+		if err != nil {
+			return nil, err
+		}
+		return tomlTableJSON(table)
+	case strings.HasPrefix(rest, "true") && !isTomlBareKeyChar(byteAt(rest, 4)):
+		p.pos += 4
+		return json.RawMessage("true"), nil
+	case strings.HasPrefix(rest, "false") && !isTomlBareKeyChar(byteAt(rest, 5)):
+		p.pos += 5
+		return json.RawMessage("false"), nil
+	}
+
+	if date := tomlDatePattern.FindString(rest); date != "" {
+		p.pos += len(date)
+		return json.Marshal(date)
+	}
+
+	start := p.pos
+	number := tomlNumberPattern.FindString(rest)
+	if number == "" {
+		return nil, p.errorf(start, "expected a value")
+	}
+	p.pos += len(number)
+	return tomlNumber(number, func(format string, args ...any) error {
+		return p.errorf(start, format, args...)
+	})
+}
+
+func byteAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
+
+func tomlNumber(number string, errorf func(format string, args ...any) error) (json.RawMessage, error) {
+	unsigned := strings.TrimLeft(number, "+-")
+	if unsigned == "inf" || unsigned == "nan" {
+		return nil, errorf("'%s' cannot be used as a value", number)
+	}
+	if strings.Contains(number, "__") || strings.HasPrefix(unsigned, "_") || strings.HasSuffix(number, "_") {
+		return nil, errorf("invalid number '%s'", number)
+	}
+	clean := strings.ReplaceAll(number, "_", "")
+
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(clean, prefix) {
+			n, err := strconv.ParseInt(clean[2:], base, 64)
+			if err != nil {
+				return nil, errorf("invalid number '%s'", number)
+			}
+			return json.RawMessage(strconv.FormatInt(n, 10)), nil
+		}
+	}
+
+	if !strings.ContainsAny(clean, ".eE") {
+		if len(unsigned) > 1 && unsigned[0] == '0' {
+			return nil, errorf("leading zeros are not allowed in '%s'", number)
+		}
+		n, err := strconv.ParseInt(clean, 10, 64)
+		if err != nil {
+			return nil, errorf("invalid number '%s'", number)
+		}
+		return json.RawMessage(strconv.FormatInt(n, 10)), nil
+	}
+
+	f, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return nil, errorf("invalid number '%s'", number)
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return json.RawMessage(s), nil
+}
+
+func (p *tomlParser) parseArray() (json.RawMessage, error) {
+	start := p.pos
+	p.pos++
+	raw := []byte{'['}
+	for {
+		p.skipBlank(true)
+		if p.pos >= len(p.data) {
+			return nil, p.errorf(start, "unterminated array")
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return append(raw, ']'), nil
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) > 1 {
+			raw = append(raw, ',')
+		}
+		raw = append(raw, value...)
+
+		p.skipBlank(true)
+		if p.pos < len(p.data) && p.data[p.pos] == ',' {
+			p.pos++
+		} else if p.pos >= len(p.data) || p.data[p.pos] != ']' {
+			return nil, p.errorf(p.pos, "expected ',' or ']' in array")
+		}
+	}
+}
+
+// parseString parses any of the four kinds of TOML string.
+func (p *tomlParser) parseString() (string, error) {
+	start := p.pos
+	quote := p.data[p.pos]
+	multiline := strings.HasPrefix(p.data[p.pos:], strings.Repeat(string(quote), 3))
+	if multiline {
+		p.pos += 3
+		// A newline right after the opening quotes is trimmed
+		if strings.HasPrefix(p.data[p.pos:], "\r\n") {
+			p.pos += 2
+		} else if strings.HasPrefix(p.data[p.pos:], "\n") {
+			p.pos++
+		}
+	} else {
+		p.pos++
+	}
+
+	var b strings.Builder
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == quote {
+			if !multiline {
+				p.pos++
+				return b.String(), nil
+			}
+			if strings.HasPrefix(p.data[p.pos:], strings.Repeat(string(quote), 3)) {
+				// Up to two quotes may sit right before the closing quotes
+				end := p.pos + 3
+				for end < len(p.data) && p.data[end] == quote && end-p.pos < 5 {
+					end++
+				}
+				b.WriteString(p.data[p.pos : end-3])
+				p.pos = end
+				return b.String(), nil
+			}
+		}
+		if c == '\n' && !multiline {
+			break
+		}
+		if c != '\\' || quote == '\'' {
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		p.pos++
+		if p.pos >= len(p.data) {
+			break
+		}
+		escape := p.data[p.pos]
+		p.pos++
+		switch escape {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case 'e':
+			b.WriteByte(0x1b)
+		case '"', '\\':
+			b.WriteByte(escape)
+		case 'u', 'U':
+			size := 4
+			if escape == 'U' {
+				size = 8
+			}
+			if p.pos+size > len(p.data) {
+				return "", p.errorf(p.pos-2, "invalid escape '\\%c'", escape)
+			}
+			code, err := strconv.ParseUint(p.data[p.pos:p.pos+size], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				return "", p.errorf(p.pos-2, "invalid escape '\\%c%s'", escape, p.data[p.pos:p.pos+size])
+			}
+			b.WriteRune(rune(code))
+			p.pos += size
+		case ' ', '\t', '\r', '\n':
+			// A backslash at the end of a line trims the following whitespace
+			rest := strings.TrimLeft(p.data[p.pos-1:], " \t")
+			if !multiline || !(strings.HasPrefix(rest, "\n") || strings.HasPrefix(rest, "\r\n")) {
+				return "", p.errorf(p.pos-2, "invalid escape '\\%c'", escape)
+			}
+			p.pos = len(p.data) - len(strings.TrimLeft(rest, " \t\r\n"))
+		default:
+			return "", p.errorf(p.pos-2, "invalid escape '\\%c'", escape)
+		}
+	}
+	return "", p.errorf(start, "unterminated string")
+}
@@ -0,0 +1,110 @@
+package gears
+
+import (
+	"log"
+	"testing"
+)
+
+func TestParseToml(t *testing.T) {
+	config := `# Top-level keys
+name = "gears" # trailing comment
+literal = 'C:\path'
+multi = """
+line one \
+  still one
+line two"""
+raw = '''
+it's raw\n'''
+port = 8_080
+hex = 0xff
+negative = -1
+ratio = 1.5
+exp = 1e-3
+on = true
+date = 1979-05-27T07:32:00Z
+tags = [
+  "a", # first
+  "b",
+]
+dotted.key = 1
+
+[server]
+port = 80
+tls = { cert = "cert.pem", key.path = "key.pem" }
+
+[server."quoted part"]
+x = 1
+`
+	entries, err := parseToml([]byte(config))
+	if err != nil {
+		t.Fatalf("parseToml failed: %v", err)
+	}
+
+	expected := []struct{ key, raw string }{
+		{"name", `"gears"`},
+		{"literal", `"C:\\path"`},
+		{"multi", `"line one still one\nline two"`},
+		{"raw", `"it's raw\\n"`},
+		{"port", `8080`},
+		{"hex", `255`},
+		{"negative", `-1`},
+		{"ratio", `1.5`},
+		{"exp", `0.001`},
+		{"on", `true`},
+		{"date", `"1979-05-27T07:32:00Z"`},
+		{"tags", `["a","b"]`},
+		{"dotted.key", `1`},
+		{"server.port", `80`},
+		{"server.tls.cert", `"cert.pem"`},
+		{"server.tls.key.path", `"key.pem"`},
+		{"server.quoted part.x", `1`},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("parseToml returned %d entries; expected %d", len(entries), len(expected))
+	}
+	for i, want := range expected {
+		if entries[i].key != want.key || string(entries[i].raw) != want.raw {
+			t.Errorf("entry %d is %s = %s; expected %s = %s", i, entries[i].key, entries[i].raw, want.key, want.raw)
+		}
+	}
+	if entries[13].line != 24 || entries[13].column != 1 {
+		t.Errorf("server-port is at %d:%d; expected 24:1", entries[13].line, entries[13].column)
+	}
+}
+
+func TestParseTomlErrors(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "server-port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadConfigData(t, "config.toml", TOML, []byte("[server]\nport = 8080\n"), "error"); err != nil {
+		t.Errorf("parseConfig failed on valid config: %v", err)
+	}
+	if IntValue("server-port") != 8080 {
+		t.Error("server-port was not set from TOML")
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"[server]\n  port = \"80\"\n", `config.toml:2:3: "server.port": expected int, got string`},
+		{"[server]\nprot = 80\n", `config.toml:2:1: "server.prot": option does not exist`},
+		{"server.port = 1\nserver.port = 2\n", `config.toml:2:1: Invalid TOML: key 'server.port' is defined more than once`},
+		{"[server]\n[server]\n", `config.toml:2:1: Invalid TOML: table 'server' is defined more than once`},
+		{"port = \n", `config.toml:1:8: Invalid TOML: expected a value`},
+		{"port = 80 90\n", `config.toml:1:11: Invalid TOML: expected the end of the line`},
+		{"name = \"abc\n", `config.toml:1:8: Invalid TOML: unterminated string`},
+		{"port = 007\n", `config.toml:1:8: Invalid TOML: leading zeros are not allowed in '007'`},
+		{"[[servers]]\n", `config.toml:1:1: Invalid TOML: arrays of tables are not supported, except for [[match]]`},
+		{"match = []\n[[match]]\n", `config.toml:2:1: Invalid TOML: key 'match' is defined more than once`},
+		{"[[match]]\n[match]\n", `config.toml:2:1: Invalid TOML: table 'match' is defined more than once`},
+	}
+	for _, test := range tests {
+		err := loadConfigData(t, "config.toml", TOML, []byte(test.config), "error")
+		if err == nil || err.Error() != test.want {
+			t.Errorf("loadConfigData(toml, %q) = %v; want %s", test.config, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package gears
+
+import (
+	"fmt"
+	"slices"
+)
+
+// A Getter reads flag values from within a rule.
+type Getter interface {
+	BoolValue(name string) bool
+	FloatValue(name string) float64
+	IntValue(name string) int
+	StringValue(name string) string
+	FloatValues(name string) []float64
+	IntValues(name string) []int
+	StringValues(name string) []string
+}
+
+type valueGetter struct{}
+
+func (valueGetter) BoolValue(name string) bool        { return BoolValue(name) }
+func (valueGetter) FloatValue(name string) float64    { return FloatValue(name) }
+func (valueGetter) IntValue(name string) int          { return IntValue(name) }
+func (valueGetter) StringValue(name string) string    { return StringValue(name) }
+func (valueGetter) FloatValues(name string) []float64 { return FloatValues(name) }
+func (valueGetter) IntValues(name string) []int       { return IntValues(name) }
+func (valueGetter) StringValues(name string) []string { return StringValues(name) }
+
+var rules []func(get Getter) error
+
+// AddRule registers a check that spans several flags, such as one flag
+// requiring another. Rules run after all layers have been loaded.
+func AddRule(rule func(get Getter) error) {
+	rules = append(rules, rule)
+}
+
+func validate() error {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var errs ConfigErrors
+
+	// Groups go first, since they may reset flags to their defaults
+	for _, err := range checkGroups() {
+		errs = append(errs, &ConfigError{Source: "validation", Message: err.Error()})
+	}
+	for _, name := range names {
+		flag := flags[name]
+		if flag.Validate == nil {
+			continue
+		}
+		if err := flag.Validate(values[name]); err != nil {
+			errs = append(errs, &ConfigError{
+				Flag:         name,
+				Source:       "validation",
+				Location:     sources[name].Location,
+				IncludedFrom: sources[name].IncludedFrom,
+				Message:      fmt.Sprintf("Invalid value for '%s': %s", name, err),
+			})
+		}
+	}
+	for _, rule := range rules {
+		if err := rule(valueGetter{}); err != nil {
+			errs = append(errs, &ConfigError{Source: "validation", Message: err.Error()})
+		}
+	}
+
+	return errs.err()
+}
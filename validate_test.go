@@ -0,0 +1,50 @@
+package gears
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "min", ValueType: "int", DefaultValue: 0}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "max", ValueType: "int", DefaultValue: 10}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80, Validate: func(v any) error {
+		if v.(int) < 1 || v.(int) > 65535 {
+			return errors.New("must be between 1 and 65535")
+		}
+		return nil
+	}}); err != nil {
+		log.Fatal(err)
+	}
+	AddRule(func(get Getter) error {
+		if get.IntValue("min") > get.IntValue("max") {
+			return errors.New("--min must be at most --max")
+		}
+		return nil
+	})
+
+	if err := validate(); err != nil {
+		t.Errorf("validate failed with valid values: %v", err)
+	}
+
+	values["min"] = 20
+	values["port"] = 0
+	err := validate()
+	if err == nil {
+		t.Fatal("validate succeeded with invalid values; expected failure")
+	}
+	if !strings.Contains(err.Error(), "'port'") {
+		t.Error("validate did not report the invalid port")
+	}
+	if !strings.Contains(err.Error(), "--min must be at most --max") {
+		t.Error("validate did not report the failed rule")
+	}
+}
@@ -0,0 +1,68 @@
+package gears
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// xdgHome returns the directory named by an XDG environment variable, or
+// else the fallback relative to the home directory. Relative paths are
+// invalid in XDG variables, so they are ignored.
+func xdgHome(envVar string, fallback string) (string, bool) {
+	if dir := os.Getenv(envVar); filepath.IsAbs(dir) {
+		return dir, true
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Println("Warning: Could not determine location of user home directory")
+		return "", false
+	}
+	return filepath.Join(home, fallback), true
+}
+
+// xdgConfigDirs returns the system config directories, most important
+// first.
+func xdgConfigDirs() []string {
+	var dirs []string
+	for _, dir := range strings.Split(os.Getenv("XDG_CONFIG_DIRS"), ":") {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = []string{"/etc/xdg"}
+	}
+	return dirs
+}
+
+// AddXDGConfigFile adds a config file from each XDG config directory, such
+// as "app/config.json". Files in $XDG_CONFIG_DIRS are added from least to
+// most important, followed by the user's file in $XDG_CONFIG_HOME (or
+// ~/.config), which takes precedence over all of them.
+func AddXDGConfigFile(path string) {
+	dirs := xdgConfigDirs()
+	slices.Reverse(dirs)
+	for _, dir := range dirs {
+		AddConfigFile(filepath.Join(dir, path))
+	}
+	if dir, ok := xdgHome("XDG_CONFIG_HOME", ".config"); ok {
+		AddConfigFile(filepath.Join(dir, path))
+	}
+}
+
+// XDGDataPath returns the path of a file in $XDG_DATA_HOME (or
+// ~/.local/share), for use as a flag's default value.
+func XDGDataPath(path string) string {
+	dir, _ := xdgHome("XDG_DATA_HOME", ".local/share")
+	return filepath.Join(dir, path)
+}
+
+// XDGStatePath returns the path of a file in $XDG_STATE_HOME (or
+// ~/.local/state), for use as a flag's default value.
+func XDGStatePath(path string) string {
+	dir, _ := xdgHome("XDG_STATE_HOME", ".local/state")
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,55 @@
+package gears
+
+import "testing"
+
+func TestAddXDGConfigFile(t *testing.T) {
+	tests_reset()
+
+	t.Setenv("HOME", "/home/test")
+	t.Setenv("XDG_CONFIG_DIRS", "/etc/xdg-first:relative:/etc/xdg-second")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	AddXDGConfigFile("app/config.json")
+
+	expected := []string{
+		"/etc/xdg-second/app/config.json",
+		"/etc/xdg-first/app/config.json",
+		"/home/test/.config/app/config.json",
+	}
+	if len(configFiles) != len(expected) {
+		t.Fatalf("AddXDGConfigFile added %d files; expected %d", len(configFiles), len(expected))
+	}
+	for i, path := range expected {
+		if configFiles[i].path != path {
+			t.Errorf("config file %d is %s; expected %s", i, configFiles[i].path, path)
+		}
+	}
+
+	tests_reset()
+	t.Setenv("XDG_CONFIG_DIRS", "")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	AddXDGConfigFile("app/config.json")
+	if len(configFiles) != 2 || configFiles[0].path != "/etc/xdg/app/config.json" || configFiles[1].path != "/xdg/config/app/config.json" {
+		t.Errorf("AddXDGConfigFile did not use the default and configured directories")
+	}
+}
+
+func TestXDGPaths(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "relative")
+	if path := XDGDataPath("app/data.db"); path != "/home/test/.local/share/app/data.db" {
+		t.Errorf("XDGDataPath = %s; expected /home/test/.local/share/app/data.db", path)
+	}
+	if path := XDGStatePath("app/history"); path != "/home/test/.local/state/app/history" {
+		t.Errorf("XDGStatePath = %s; expected /home/test/.local/state/app/history", path)
+	}
+
+	t.Setenv("XDG_DATA_HOME", "/xdg/data")
+	t.Setenv("XDG_STATE_HOME", "/xdg/state")
+	if path := XDGDataPath("app/data.db"); path != "/xdg/data/app/data.db" {
+		t.Errorf("XDGDataPath = %s; expected /xdg/data/app/data.db", path)
+	}
+	if path := XDGStatePath("app/history"); path != "/xdg/state/app/history" {
+		t.Errorf("XDGStatePath = %s; expected /xdg/state/app/history", path)
+	}
+}
@@ -0,0 +1,1006 @@
+package gears
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This is a small YAML reader covering what config files need: block and
+// flow mappings and sequences, plain, quoted and block scalars, comments,
+// anchors, aliases and merge keys. Tags and multiple documents are not
+// supported.
+
+type yamlNode struct {
+	// kind is one of: scalar mapping sequence
+	kind string
+	// value is the text of a scalar
+	value string
+	// quoted scalars are always strings, while plain scalars are resolved
+	// to null, bool, int, float or string
+	quoted bool
+	keys   []*yamlNode
+	items  []*yamlNode
+	line   int
+	column int
+}
+
+type yamlError struct {
+	line    int
+	column  int
+	message string
+}
+
+func (e *yamlError) Error() string {
+	return e.message
+}
+
+type yamlParser struct {
+	lines   []string
+	n       int
+	anchors map[string]*yamlNode
+}
+
+func (p *yamlParser) errorf(line int, column int, format string, args ...any) error {
+	return &yamlError{line: line + 1, column: column + 1, message: fmt.Sprintf(format, args...)}
+}
+
+// parseYaml reads the keys of a YAML config file, along with the position of
+// each key.
+func parseYaml(data []byte) ([]configEntry, error) {
+	p := &yamlParser{
+		lines:   strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"),
+		anchors: make(map[string]*yamlNode),
+	}
+
+	node, err := p.parseDocument()
+	if err == nil && node.kind == "scalar" && !node.quoted && resolvesToNull(node.value) {
+		return nil, nil
+	}
+	if err == nil && node.kind != "mapping" {
+		err = p.errorf(node.line-1, node.column-1, "config must be a mapping")
+	}
+	if err != nil {
+		yamlErr := err.(*yamlError)
+		return nil, configError(yamlErr.line, yamlErr.column, "", "Invalid YAML: "+yamlErr.message)
+	}
+
+	return yamlEntries(node, "")
+}
+
+// yamlEntries reads the keys of a mapping, flattening nested mappings into
+// keys like "server.port".
+func yamlEntries(node *yamlNode, prefix string) ([]configEntry, error) {
+	var entries []configEntry
+	for i, keyNode := range node.keys {
+		key := prefix + keyNode.value
+		if node.items[i].kind == "mapping" && isNestedConfig(key) {
+			nested, err := yamlEntries(node.items[i], key+".")
+			if err != nil {
+				return nil, err
+			}
+			if len(nested) == 0 {
+				nested = []configEntry{{key: key, section: true, line: keyNode.line, column: keyNode.column}}
+			}
+			entries = append(entries, nested...)
+			continue
+		}
+
+		raw, err := node.items[i].json()
+		if err != nil {
+			yamlErr := err.(*yamlError)
+			return nil, configError(yamlErr.line, yamlErr.column, configFlagName(key), fmt.Sprintf("\"%s\": %s", key, yamlErr.message))
+		}
+		entries = append(entries, configEntry{key: key, raw: raw, line: keyNode.line, column: keyNode.column})
+	}
+	return entries, nil
+}
+
+func (p *yamlParser) parseDocument() (*yamlNode, error) {
+	// Blank out directives and document markers, allowing a single document
+	started := false
+	for i, line := range p.lines {
+		if strings.HasPrefix(line, "%") && !started {
+			p.lines[i] = ""
+		} else if line == "---" || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "---\t") {
+			if started {
+				return nil, p.errorf(i, 0, "multiple documents are not supported")
+			}
+			if rest := stripYamlComment(line[3:]); strings.TrimSpace(rest) != "" {
+				return nil, p.errorf(i, 4, "content after '---' is not supported")
+			}
+			started = true
+			p.lines[i] = ""
+		} else if line == "..." || strings.HasPrefix(line, "... ") {
+			p.lines = p.lines[:i]
+			break
+		} else if !isYamlBlank(line) {
+			started = true
+		}
+	}
+
+	node, err := p.parseBlock(0)
+	if err != nil {
+		return nil, err
+	}
+	if i := p.next(); i >= 0 {
+		return nil, p.errorf(i, yamlIndent(p.lines[i]), "unexpected content")
+	}
+	return node, nil
+}
+
+func isYamlBlank(line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	return trimmed == "" || trimmed[0] == '#'
+}
+
+func yamlIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// next returns the index of the next line with content, or -1.
+func (p *yamlParser) next() int {
+	for i := p.n; i < len(p.lines); i++ {
+		if !isYamlBlank(p.lines[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYamlComment removes a trailing comment from text that is not inside
+// quotes.
+func stripYamlComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" \t[{,:", text[i-1]) != -1 {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || text[i-1] == ' ' || text[i-1] == '\t' {
+				return text[:i]
+			}
+		}
+	}
+	return text
+}
+
+func isYamlSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ") || strings.HasPrefix(content, "-\t")
+}
+
+// splitYamlKey splits "key: value" into its key and the offset of the value.
+func splitYamlKey(content string) (string, int, bool) {
+	if content == "" || strings.IndexByte("[{?|>&*!", content[0]) != -1 || isYamlSequenceItem(content) {
+		return "", 0, false
+	}
+
+	i := 0
+	if content[0] == '"' || content[0] == '\'' {
+		quote := content[0]
+		for i = 1; i < len(content); i++ {
+			if content[i] == '\\' && quote == '"' {
+				i++
+			} else if content[i] == quote {
+				if quote == '\'' && i+1 < len(content) && content[i+1] == '\'' {
+					i++
+				} else {
+					break
+				}
+			}
+		}
+		if i >= len(content) {
+			return "", 0, false
+		}
+		i++
+		for i < len(content) && content[i] == ' ' {
+			i++
+		}
+		if i < len(content) && content[i] == ':' && (i+1 == len(content) || content[i+1] == ' ' || content[i+1] == '\t') {
+			return content[:i], i + 1, true
+		}
+		return "", 0, false
+	}
+
+	for ; i < len(content); i++ {
+		if content[i] == '#' && i > 0 && (content[i-1] == ' ' || content[i-1] == '\t') {
+			return "", 0, false
+		}
+		if content[i] == ':' && (i+1 == len(content) || content[i+1] == ' ' || content[i+1] == '\t') {
+			return strings.TrimRight(content[:i], " \t"), i + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// checkTabs reports a tab in the indentation of line i. It must run before
+// the line's indentation is compared, since tabs do not count towards it.
+func (p *yamlParser) checkTabs(i int) error {
+	if i < 0 {
+		return nil
+	}
+	line := p.lines[i]
+	indent := yamlIndent(line)
+	if indent < len(line) && line[indent] == '\t' {
+		return p.errorf(i, indent, "tabs are not allowed for indentation")
+	}
+	return nil
+}
+
+// parseBlock parses the node starting on the next line with content,
+// which must be indented by at least minIndent. A missing node is null.
+func (p *yamlParser) parseBlock(minIndent int) (*yamlNode, error) {
+	i := p.next()
+	if err := p.checkTabs(i); err != nil {
+		return nil, err
+	}
+	if i < 0 || yamlIndent(p.lines[i]) < minIndent {
+		return &yamlNode{kind: "scalar", line: p.n + 1, column: minIndent + 1}, nil
+	}
+
+	line := p.lines[i]
+	indent := yamlIndent(line)
+	content := line[indent:]
+	if isYamlSequenceItem(content) {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYamlKey(content); ok {
+		return p.parseMapping(indent)
+	}
+	p.n = i
+	return p.parseInline(i, indent, minIndent-1)
+}
+
+func (p *yamlParser) parseMapping(indent int) (*yamlNode, error) {
+	start := p.next()
+	node := &yamlNode{kind: "mapping", line: start + 1, column: indent + 1}
+	var merges []*yamlNode
+	for {
+		i := p.next()
+		if err := p.checkTabs(i); err != nil {
+			return nil, err
+		}
+		if i < 0 || yamlIndent(p.lines[i]) < indent {
+			break
+		}
+		if yamlIndent(p.lines[i]) > indent {
+			return nil, p.errorf(i, yamlIndent(p.lines[i]), "unexpected indentation")
+		}
+		content := p.lines[i][indent:]
+		keyText, valueOffset, ok := splitYamlKey(content)
+		if !ok {
+			if isYamlSequenceItem(content) {
+				return nil, p.errorf(i, indent, "expected a key, got a sequence item")
+			}
+			return nil, p.errorf(i, indent, "expected 'key: value'")
+		}
+
+		key, err := p.parseScalar(keyText, i, indent)
+		if err != nil {
+			return nil, err
+		}
+
+		var value *yamlNode
+		rest := stripYamlComment(content[valueOffset:])
+		p.n = i + 1
+		if strings.TrimSpace(rest) == "" {
+			// Sequences may sit at the same indentation as their key
+			if j := p.next(); j >= 0 && yamlIndent(p.lines[j]) == indent && isYamlSequenceItem(p.lines[j][indent:]) {
+				value, err = p.parseSequence(indent)
+			} else {
+				value, err = p.parseBlock(indent + 1)
+			}
+		} else {
+			value, err = p.parseInline(i, indent+valueOffset, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if key.value == "<<" && !key.quoted {
+			switch value.kind {
+			case "mapping":
+				merges = append(merges, value)
+			case "sequence":
+				for _, item := range value.items {
+					if item.kind != "mapping" {
+						return nil, p.errorf(i, indent, "merge key '<<' needs a mapping")
+					}
+					merges = append(merges, item)
+				}
+			default:
+				return nil, p.errorf(i, indent, "merge key '<<' needs a mapping")
+			}
+			continue
+		}
+
+		if node.lookup(key.value) != nil {
+			return nil, p.errorf(i, indent, "duplicate key '%s'", key.value)
+		}
+		node.keys = append(node.keys, key)
+		node.items = append(node.items, value)
+	}
+
+	// Keys set directly take precedence over merged ones, and earlier
+	// merges take precedence over later ones
+	for _, merge := range merges {
+		for j, key := range merge.keys {
+			if node.lookup(key.value) == nil {
+				node.keys = append(node.keys, key)
+				node.items = append(node.items, merge.items[j])
+			}
+		}
+	}
+	return node, nil
+}
+
+func (node *yamlNode) lookup(key string) *yamlNode {
+	for i, k := range node.keys {
+		if k.value == key {
+			return node.items[i]
+		}
+	}
+	return nil
+}
+
+func (p *yamlParser) parseSequence(indent int) (*yamlNode, error) {
+	start := p.next()
+	node := &yamlNode{kind: "sequence", line: start + 1, column: indent + 1}
+	for {
+		i := p.next()
+		if err := p.checkTabs(i); err != nil {
+			return nil, err
+		}
+		if i < 0 || yamlIndent(p.lines[i]) < indent {
+			break
+		}
+		if yamlIndent(p.lines[i]) > indent {
+			return nil, p.errorf(i, yamlIndent(p.lines[i]), "unexpected indentation")
+		}
+		content := p.lines[i][indent:]
+		if !isYamlSequenceItem(content) {
+			break
+		}
+
+		if strings.TrimSpace(stripYamlComment(content[1:])) == "" {
+			p.n = i + 1
+		} else {
+			// Blank out the "-", so that the item's content starts a block
+			// of its own at the column it is written in
+			p.lines[i] = p.lines[i][:indent] + " " + p.lines[i][indent+1:]
+			p.n = i
+		}
+		item, err := p.parseBlock(indent + 1)
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+	}
+	return node, nil
+}
+
+// parseInline parses a node that starts on line i at column start, and
+// belongs to a parent at parentIndent.
+func (p *yamlParser) parseInline(i int, start int, parentIndent int) (*yamlNode, error) {
+	text := stripYamlComment(p.lines[i][start:])
+	commented := text != p.lines[i][start:]
+	trimmed := strings.TrimLeft(text, " \t")
+	start += len(text) - len(trimmed)
+	text = strings.TrimRight(trimmed, " \t")
+	p.n = i + 1
+
+	if strings.HasPrefix(text, "&") {
+		name, rest, _ := strings.Cut(text[1:], " ")
+		if name == "" {
+			return nil, p.errorf(i, start, "anchor is missing a name")
+		}
+		var node *yamlNode
+		var err error
+		if rest = strings.TrimSpace(rest); rest == "" {
+			node, err = p.parseBlock(parentIndent + 1)
+		} else {
+			node, err = p.parseInline(i, start+len(text)-len(rest), parentIndent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.anchors[name] = node
+		return node, nil
+	}
+
+	if strings.HasPrefix(text, "*") {
+		node, exists := p.anchors[text[1:]]
+		if !exists {
+			return nil, p.errorf(i, start, "unknown alias '%s'", text)
+		}
+		return node, nil
+	}
+
+	if strings.HasPrefix(text, "!") {
+		return nil, p.errorf(i, start, "tags are not supported")
+	}
+
+	if strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">") {
+		return p.parseBlockScalar(i, start, text, parentIndent)
+	}
+
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return p.parseFlow(i, start)
+	}
+
+	if text[0] == '"' || text[0] == '\'' {
+		return p.parseQuotedLines(text, i, start, parentIndent)
+	}
+	if !commented {
+		text += p.plainContinuation(parentIndent)
+	}
+	return p.parseScalar(text, i, start)
+}
+
+// plainContinuation reads the lines that continue a plain scalar, which
+// are indented past parentIndent, and returns them folded as they are to be
+// appended to its first line: line breaks become spaces, and each empty line
+// becomes a newline.
+func (p *yamlParser) plainContinuation(parentIndent int) string {
+	var b strings.Builder
+	breaks := 0
+	for j := p.n; j < len(p.lines); j++ {
+		line := p.lines[j]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			breaks++
+			continue
+		}
+		if trimmed[0] == '#' || yamlIndent(line) <= parentIndent {
+			break
+		}
+		if _, _, ok := splitYamlKey(trimmed); ok {
+			break
+		}
+
+		text := stripYamlComment(trimmed)
+		b.WriteString(yamlFold(breaks))
+		b.WriteString(strings.TrimRight(text, " \t"))
+		breaks = 0
+		p.n = j + 1
+		if text != trimmed {
+			// A comment ends the scalar
+			break
+		}
+	}
+	return b.String()
+}
+
+// parseQuotedLines parses a quoted scalar that starts on line i, and may
+// continue on the following lines indented past parentIndent. Line breaks
+// are folded like in plain scalars, except that an escaped line break in a
+// double-quoted scalar is dropped.
+func (p *yamlParser) parseQuotedLines(text string, i int, start int, parentIndent int) (*yamlNode, error) {
+	breaks := 0
+	for j := p.n; ; j++ {
+		_, _, err := unquoteYaml(text)
+		if !errors.Is(err, errYamlUnterminated) {
+			break
+		}
+		if j >= len(p.lines) {
+			return nil, p.errorf(i, start, "%s", err)
+		}
+
+		line := p.lines[j]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			breaks++
+			continue
+		}
+		if yamlIndent(line) <= parentIndent {
+			return nil, p.errorf(i, start, "%s", err)
+		}
+
+		escapes := len(text) - len(strings.TrimRight(text, "\\"))
+		if text[0] == '"' && breaks == 0 && escapes%2 == 1 {
+			text = text[:len(text)-1]
+		} else {
+			text += yamlFold(breaks)
+		}
+		text += trimmed
+		breaks = 0
+		p.n = j + 1
+	}
+
+	if p.n == i+1 {
+		return p.parseScalar(text, i, start)
+	}
+	// The last line's comment is still in text, since its quotes could not
+	// be told apart from those of the first line
+	_, end, _ := unquoteYaml(text)
+	if rest := stripYamlComment(text[end:]); strings.TrimSpace(rest) != "" {
+		return nil, p.errorf(p.n-1, yamlIndent(p.lines[p.n-1]), "unexpected text after quoted string")
+	}
+	return p.parseScalar(text[:end], i, start)
+}
+
+// yamlFold returns what a line break followed by the given number of empty
+// lines becomes in a folded scalar.
+func yamlFold(breaks int) string {
+	if breaks == 0 {
+		return " "
+	}
+	return strings.Repeat("\n", breaks)
+}
+
+// parseScalar parses a plain or quoted scalar, with any continuation lines
+// already joined onto text.
+func (p *yamlParser) parseScalar(text string, i int, start int) (*yamlNode, error) {
+	node := &yamlNode{kind: "scalar", line: i + 1, column: start + 1}
+	if text == "" || (text[0] != '"' && text[0] != '\'') {
+		node.value = text
+		return node, nil
+	}
+
+	value, end, err := unquoteYaml(text)
+	if err != nil {
+		return nil, p.errorf(i, start, "%s", err)
+	}
+	if strings.TrimSpace(text[end:]) != "" {
+		return nil, p.errorf(i, start+end, "unexpected text after quoted string")
+	}
+	node.value = value
+	node.quoted = true
+	return node, nil
+}
+
+var errYamlUnterminated = errors.New("unterminated string")
+
+// unquoteYaml reads the quoted string at the start of text, returning its
+// value and the offset just past the closing quote.
+func unquoteYaml(text string) (string, int, error) {
+	quote := text[0]
+	var b strings.Builder
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		if c == quote {
+			if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), i + 1, nil
+		}
+		if c != '\\' || quote == '\'' {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i >= len(text) {
+			break
+		}
+		switch text[i] {
+		case '0':
+			b.WriteByte(0)
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 't', '\t':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'v':
+			b.WriteByte('\v')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case 'e':
+			b.WriteByte(0x1b)
+		case ' ', '"', '/', '\\':
+			b.WriteByte(text[i])
+		case 'N':
+			b.WriteString("\u0085")
+		case '_':
+			b.WriteString("\u00a0")
+		case 'L':
+			b.WriteString("\u2028")
+		case 'P':
+			b.WriteString("\u2029")
+		case 'x', 'u', 'U':
+			size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[text[i]]
+			if i+size >= len(text) {
+				return "", 0, fmt.Errorf("invalid escape '\\%c'", text[i])
+			}
+			code, err := strconv.ParseUint(text[i+1:i+1+size], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				return "", 0, fmt.Errorf("invalid escape '\\%s'", text[i:i+1+size])
+			}
+			b.WriteRune(rune(code))
+			i += size
+		default:
+			return "", 0, fmt.Errorf("invalid escape '\\%c'", text[i])
+		}
+	}
+	return "", 0, errYamlUnterminated
+}
+
+// parseBlockScalar parses a literal (|) or folded (>) block scalar.
+func (p *yamlParser) parseBlockScalar(i int, start int, header string, parentIndent int) (*yamlNode, error) {
+	node := &yamlNode{kind: "scalar", quoted: true, line: i + 1, column: start + 1}
+	folded := header[0] == '>'
+	chomp := ""
+	indent := 0
+	for _, c := range header[1:] {
+		switch {
+		case (c == '-' || c == '+') && chomp == "":
+			chomp = string(c)
+		case c >= '1' && c <= '9' && indent == 0:
+			indent = max(parentIndent, 0) + int(c-'0')
+		default:
+			return nil, p.errorf(i, start, "invalid block scalar header '%s'", header)
+		}
+	}
+	if indent == 0 {
+		// Detect the indentation from the first line with content
+		for j := i + 1; j < len(p.lines); j++ {
+			if strings.TrimSpace(p.lines[j]) != "" {
+				indent = yamlIndent(p.lines[j])
+				break
+			}
+		}
+		if indent <= parentIndent {
+			indent = parentIndent + 1
+		}
+	}
+
+	var lines []string
+	j := i + 1
+	for ; j < len(p.lines); j++ {
+		line := p.lines[j]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if yamlIndent(line) < indent {
+			break
+		}
+		lines = append(lines, line[indent:])
+	}
+	p.n = j
+
+	// Trailing blank lines only matter for keep chomping
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var b strings.Builder
+	for k, line := range lines {
+		if k > 0 {
+			b.WriteString(yamlLineBreak(folded, lines, k))
+		}
+		b.WriteString(line)
+	}
+	node.value = b.String()
+
+	switch {
+	case chomp == "-" || len(lines) == 0 && chomp == "":
+	case chomp == "+":
+		node.value += strings.Repeat("\n", trailing+1)
+	default:
+		node.value += "\n"
+	}
+	return node, nil
+}
+
+// yamlLineBreak returns what the line break before lines[k] becomes.
+func yamlLineBreak(folded bool, lines []string, k int) string {
+	if !folded {
+		return "\n"
+	}
+	isNormal := func(line string) bool {
+		return line != "" && line[0] != ' ' && line[0] != '\t'
+	}
+
+	prev := lines[k-1]
+	if prev == "" {
+		return "\n"
+	}
+	if !isNormal(prev) {
+		return "\n"
+	}
+	if isNormal(lines[k]) {
+		return " "
+	}
+	if lines[k] != "" {
+		return "\n"
+	}
+	// A break followed by empty lines is dropped, unless the next line
+	// with content is more indented
+	for _, line := range lines[k:] {
+		if line != "" {
+			if isNormal(line) {
+				return ""
+			}
+			return "\n"
+		}
+	}
+	return ""
+}
+
+// parseFlow parses a flow collection such as [a, b] or {a: 1}, which may
+// span several lines.
+func (p *yamlParser) parseFlow(i int, start int) (*yamlNode, error) {
+	// Join lines until the brackets are balanced
+	var b strings.Builder
+	depth := 0
+	var quote byte
+	j := i
+	col := start
+	for ; j < len(p.lines); j++ {
+		line := stripYamlComment(p.lines[j][col:])
+		for k := 0; k < len(line); k++ {
+			c := line[k]
+			switch {
+			case quote == '"' && c == '\\':
+				k++
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				depth--
+			}
+		}
+		b.WriteString(line)
+		b.WriteByte(' ')
+		col = 0
+		if depth <= 0 {
+			break
+		}
+	}
+	if depth > 0 {
+		return nil, p.errorf(i, start, "unterminated flow collection")
+	}
+	p.n = j + 1
+
+	flow := &yamlFlow{text: b.String(), parser: p, line: i, column: start}
+	node, err := flow.parse()
+	if err != nil {
+		return nil, err
+	}
+	flow.skipSpace()
+	if flow.pos < len(flow.text) {
+		return nil, p.errorf(i, start, "unexpected text after flow collection")
+	}
+	return node, nil
+}
+
+// yamlFlow parses flow collections. Errors are reported at the start of the
+// collection.
+type yamlFlow struct {
+	text   string
+	pos    int
+	parser *yamlParser
+	line   int
+	column int
+}
+
+func (f *yamlFlow) errorf(format string, args ...any) error {
+	return f.parser.errorf(f.line, f.column, format, args...)
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.pos < len(f.text) && (f.text[f.pos] == ' ' || f.text[f.pos] == '\t') {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) parse() (*yamlNode, error) {
+	f.skipSpace()
+	if f.pos >= len(f.text) {
+		return nil, f.errorf("unexpected end of flow collection")
+	}
+
+	node := &yamlNode{line: f.line + 1, column: f.column + 1}
+	switch c := f.text[f.pos]; c {
+	case '[', '{':
+		f.pos++
+		closing := byte(']')
+		node.kind = "sequence"
+		if c == '{' {
+			closing = '}'
+			node.kind = "mapping"
+		}
+		for {
+			f.skipSpace()
+			if f.pos < len(f.text) && f.text[f.pos] == closing {
+				f.pos++
+				return node, nil
+			}
+
+			item, err := f.parse()
+			if err != nil {
+				return nil, err
+			}
+			if node.kind == "mapping" {
+				if item.kind != "scalar" {
+					return nil, f.errorf("mapping keys must be scalars")
+				}
+				f.skipSpace()
+				value := &yamlNode{kind: "scalar", line: item.line, column: item.column}
+				if f.pos < len(f.text) && f.text[f.pos] == ':' {
+					f.pos++
+					if value, err = f.parse(); err != nil {
+						return nil, err
+					}
+				}
+				if node.lookup(item.value) != nil {
+					return nil, f.errorf("duplicate key '%s'", item.value)
+				}
+				node.keys = append(node.keys, item)
+				node.items = append(node.items, value)
+			} else {
+				node.items = append(node.items, item)
+			}
+
+			f.skipSpace()
+			if f.pos < len(f.text) && f.text[f.pos] == ',' {
+				f.pos++
+			} else if f.pos >= len(f.text) || f.text[f.pos] != closing {
+				return nil, f.errorf("expected ',' or '%c' in flow collection", closing)
+			}
+		}
+	case '"', '\'':
+		value, end, err := unquoteYaml(f.text[f.pos:])
+		if err != nil {
+			return nil, f.errorf("%s", err)
+		}
+		f.pos += end
+		node.kind = "scalar"
+		node.value = value
+		node.quoted = true
+		return node, nil
+	case '*':
+		end := f.pos + 1
+		for end < len(f.text) && strings.IndexByte(" \t,]}", f.text[end]) == -1 {
+			end++
+		}
+		alias, exists := f.parser.anchors[f.text[f.pos+1:end]]
+		if !exists {
+			return nil, f.errorf("unknown alias '%s'", f.text[f.pos:end])
+		}
+		f.pos = end
+		return alias, nil
+	case ']', '}', ',':
+		// An empty entry, like the value in "{a: }"
+		node.kind = "scalar"
+		return node, nil
+	}
+
+	// Plain scalars end at a flow indicator, or at ": "
+	end := f.pos
+	for end < len(f.text) {
+		c := f.text[end]
+		if strings.IndexByte(",[]{}", c) != -1 {
+			break
+		}
+		if c == ':' && (end+1 == len(f.text) || strings.IndexByte(" \t,[]{}", f.text[end+1]) != -1) {
+			break
+		}
+		end++
+	}
+	node.kind = "scalar"
+	node.value = strings.TrimSpace(f.text[f.pos:end])
+	f.pos = end
+	return node, nil
+}
+
+var yamlIntPattern = regexp.MustCompile(`^[-+]?[0-9]+$`)
+var yamlFloatPattern = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+
+func resolvesToNull(value string) bool {
+	return value == "" || value == "~" || value == "null" || value == "Null" || value == "NULL"
+}
+
+// json converts a node to JSON, resolving plain scalars using the YAML 1.2
+// core schema.
+func (node *yamlNode) json() (json.RawMessage, error) {
+	switch node.kind {
+	case "mapping":
+		var b bytes.Buffer
+		b.WriteByte('{')
+		for i, key := range node.keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			k, _ := json.Marshal(key.value)
+			b.Write(k)
+			b.WriteByte(':')
+			v, err := node.items[i].json()
+			if err != nil {
+				return nil, err
+			}
+			b.Write(v)
+		}
+		b.WriteByte('}')
+		return b.Bytes(), nil
+	case "sequence":
+		var b bytes.Buffer
+		b.WriteByte('[')
+		for i, item := range node.items {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			v, err := item.json()
+			if err != nil {
+				return nil, err
+			}
+			b.Write(v)
+		}
+		b.WriteByte(']')
+		return b.Bytes(), nil
+	}
+
+	value := node.value
+	if node.quoted {
+		return json.Marshal(value)
+	}
+
+	switch {
+	case resolvesToNull(value):
+		return json.RawMessage("null"), nil
+	case value == "true" || value == "True" || value == "TRUE":
+		return json.RawMessage("true"), nil
+	case value == "false" || value == "False" || value == "FALSE":
+		return json.RawMessage("false"), nil
+	case yamlIntPattern.MatchString(value):
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, &yamlError{node.line, node.column, fmt.Sprintf("int '%s' is out of range", value)}
+		}
+		return json.RawMessage(strconv.FormatInt(n, 10)), nil
+	case strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0o"):
+		base := 16
+		if value[1] == 'o' {
+			base = 8
+		}
+		if n, err := strconv.ParseInt(value[2:], base, 64); err == nil {
+			return json.RawMessage(strconv.FormatInt(n, 10)), nil
+		}
+	case yamlFloatPattern.MatchString(value):
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, &yamlError{node.line, node.column, fmt.Sprintf("float '%s' is out of range", value)}
+		}
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return json.RawMessage(s), nil
+	case strings.EqualFold(strings.TrimLeft(value, "+-"), ".inf") || strings.EqualFold(value, ".nan"):
+		return nil, &yamlError{node.line, node.column, fmt.Sprintf("'%s' cannot be used as a value", value)}
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,171 @@
+package gears
+
+import (
+	"log"
+	"testing"
+)
+
+func TestParseYaml(t *testing.T) {
+	config := `%YAML 1.2
+---
+# Server settings
+name: "gears" # trailing comment
+plain: hello world
+url: http://example.com:8080/path
+quoted: 'it''s'
+escaped: "tab\thereé"
+port: 8080
+hex: 0x1F
+ratio: 1.5
+exp: 1e3
+on: true
+off: False
+nothing: ~
+empty:
+tags: [a, "b c", 3]
+inline: {x: 1, "y": [true, null]}
+multi-flow: [
+  one, # first
+  two,
+]
+list:
+  - 1
+  - 2
+same-indent-list:
+- a
+- b
+objects:
+  - name: first
+    size: 1
+  - name: second
+literal: |
+  line one
+   indented
+  line three
+folded: >-
+  folded
+  text
+
+  new paragraph
+kept: |+
+  keep
+
+plain-lines: first
+  second
+
+  third # comment
+quoted-lines: "one
+  two \
+  three"
+single-lines: 'it''s
+  here'
+base: &base
+  host: localhost
+  port: 80
+derived:
+  <<: *base
+  port: 81
+alias: *base
+...
+ignored: after end
+`
+	entries, err := parseYaml([]byte(config))
+	if err != nil {
+		t.Fatalf("parseYaml failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"name":             `"gears"`,
+		"plain":            `"hello world"`,
+		"url":              `"http://example.com:8080/path"`,
+		"quoted":           `"it's"`,
+		"escaped":          `"tab\thereé"`,
+		"port":             `8080`,
+		"hex":              `31`,
+		"ratio":            `1.5`,
+		"exp":              `1000.0`,
+		"on":               `true`,
+		"off":              `false`,
+		"nothing":          `null`,
+		"empty":            `null`,
+		"tags":             `["a","b c",3]`,
+		"inline.x":         `1`,
+		"inline.y":         `[true,null]`,
+		"multi-flow":       `["one","two"]`,
+		"list":             `[1,2]`,
+		"same-indent-list": `["a","b"]`,
+		"objects":          `[{"name":"first","size":1},{"name":"second"}]`,
+		"literal":          `"line one\n indented\nline three\n"`,
+		"folded":           `"folded text\nnew paragraph"`,
+		"kept":             `"keep\n\n"`,
+		"plain-lines":      `"first second\nthird"`,
+		"quoted-lines":     `"one two three"`,
+		"single-lines":     `"it's here"`,
+		"base.host":        `"localhost"`,
+		"base.port":        `80`,
+		"derived.port":     `81`,
+		"derived.host":     `"localhost"`,
+		"alias.host":       `"localhost"`,
+		"alias.port":       `80`,
+	}
+	if len(entries) != len(expected) {
+		t.Errorf("parseYaml returned %d entries; expected %d", len(entries), len(expected))
+	}
+	for _, entry := range entries {
+		want, exists := expected[entry.key]
+		if !exists {
+			t.Errorf("unexpected key '%s'", entry.key)
+		} else if string(entry.raw) != want {
+			t.Errorf("%s is %s; expected %s", entry.key, entry.raw, want)
+		}
+	}
+	if entries[1].line != 5 || entries[1].column != 1 {
+		t.Errorf("plain is at %d:%d; expected 5:1", entries[1].line, entries[1].column)
+	}
+}
+
+func TestParseYamlErrors(t *testing.T) {
+	tests_reset()
+
+	if err := Add(&Flag{Name: "port", ValueType: "int", DefaultValue: 80}); err != nil {
+		log.Fatal(err)
+	}
+	if err := Add(&Flag{Name: "tags", ValueType: "strings", DefaultValue: []string{}}); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadConfigData(t, "config.yaml", YAML, []byte("port: 8080\ntags:\n  - a\n  - b\n"), "error"); err != nil {
+		t.Errorf("parseConfig failed on valid config: %v", err)
+	}
+	if IntValue("port") != 8080 || len(StringValues("tags")) != 2 {
+		t.Error("values were not set from YAML")
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"# comment\nport: \"80\"\n", `config.yaml:2:1: "port": expected int, got string`},
+		{"tags:\n  - a\n  - 1\n", `config.yaml:1:1: "tags": expected array of strings, got int at index 1`},
+		{"port: 1\n  prot: 80\n", `config.yaml:2:3: Invalid YAML: unexpected indentation`},
+		{"server:\n\tport: 1\n", `config.yaml:2:1: Invalid YAML: tabs are not allowed for indentation`},
+		{"port: 1\n\ttags: []\n", `config.yaml:2:1: Invalid YAML: tabs are not allowed for indentation`},
+		{"tags:\n  - a\n\t- b\n", `config.yaml:3:1: Invalid YAML: tabs are not allowed for indentation`},
+		{"server:\n  port: 1\n", `config.yaml:2:3: "server.port": option does not exist`},
+		{"port:\n  value: 1\n", `config.yaml:1:1: "port": expected int, got object`},
+		{"port: 1\nport: 2\n", `config.yaml:2:1: Invalid YAML: duplicate key 'port'`},
+		{"port: *missing\n", `config.yaml:1:7: Invalid YAML: unknown alias '*missing'`},
+		{"tags: [a, b\n", `config.yaml:1:7: Invalid YAML: unterminated flow collection`},
+		{"port: \"80\n", `config.yaml:1:7: Invalid YAML: unterminated string`},
+		{"port: \"80\ntags: []\n", `config.yaml:1:7: Invalid YAML: unterminated string`},
+		{"port: \"8\n  0\" 1\n", `config.yaml:2:3: Invalid YAML: unexpected text after quoted string`},
+		{"- a\n- b\n", `config.yaml:1:1: Invalid YAML: config must be a mapping`},
+		{"port: 1\n---\nport: 2\n", `config.yaml:2:1: Invalid YAML: multiple documents are not supported`},
+		{"port: .inf\n", `config.yaml:1:7: "port": '.inf' cannot be used as a value`},
+	}
+	for _, test := range tests {
+		err := loadConfigData(t, "config.yaml", YAML, []byte(test.config), "error")
+		if err == nil || err.Error() != test.want {
+			t.Errorf("loadConfigData(yaml, %q) = %v; want %s", test.config, err, test.want)
+		}
+	}
+}